@@ -2,10 +2,23 @@ package gott
 
 import (
 	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"os"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
 )
 
 func testData() [][]string {
@@ -80,7 +93,7 @@ func TestEncoderDecoder(t *testing.T) {
 		T体重:  12.23,
 		档案:   "no write",
 		T档案:  []byte{45, 44, 43},
-		Time: time.Now().Truncate(time.Second),
+		Time: time.Now().Round(0),
 		Dup:  "123",
 	}
 	buf := &bytes.Buffer{}
@@ -89,6 +102,7 @@ func TestEncoderDecoder(t *testing.T) {
 		t.Fatal(err)
 	}
 	dec := NewDecoder(buf)
+	dec.Location = time.Local
 	outData := new(TestData)
 	if err := dec.Decode(outData); err != nil {
 		t.Fatal(err)
@@ -96,7 +110,8 @@ func TestEncoderDecoder(t *testing.T) {
 	if reflect.DeepEqual(outData, data) {
 		t.Fatal("equ")
 	}
-	outData.Dup = "123"
+	//嵌入结构的Dup被外层的Dup覆盖，不会写入
+	outData.inlineStr.Dup = []byte{1, 2, 3}
 	outData.档案 = "no write"
 	if !reflect.DeepEqual(outData, data) {
 		fmt.Printf("%#v\n%#v", data, outData)
@@ -122,3 +137,1847 @@ func BenchmarkReader(b *testing.B) {
 		r.Read()
 	}
 }
+
+func TestTypeVersion(t *testing.T) {
+	type TVer struct {
+		One string
+	}
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	if err := enc.Encode(&TVer{"v1"}); err != nil {
+		t.Fatal(err)
+	}
+	{
+		//模拟程序升级后同名类型的属性发生了变化
+		type TVer struct {
+			One string
+			Two int
+		}
+		if err := enc.Encode(&TVer{"v2", 2}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := enc.Encode(&TVer{"v1 again"}); err != nil {
+		t.Fatal(err)
+	}
+	r := NewReader(bytes.NewReader(buf.Bytes()))
+	r.FieldsPerRecord = -1
+	lines, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines[0][2] != "TVer#1" || lines[2][2] != "TVer#2" || lines[4][0] != "@" || lines[4][2] != "TVer#1" {
+		t.Fatalf("wrong type lines:%#v", lines)
+	}
+	dec := NewDecoder(buf)
+	out := struct {
+		One string
+		Two int
+	}{}
+	for _, want := range []string{"v1", "v2", "v1 again"} {
+		if err := dec.Decode(&out); err != nil {
+			t.Fatal(err)
+		}
+		if out.One != want {
+			t.Fatalf("want %q,got %q", want, out.One)
+		}
+	}
+	if out.Two != 2 {
+		t.Fatalf("want 2,got %d", out.Two)
+	}
+}
+
+func TestAppendEncoder(t *testing.T) {
+	type TVer struct {
+		One string
+	}
+	name := t.TempDir() + "/append.tt"
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewEncoder(f).Encode(&TVer{"v1"}); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	//重新启动后追加写入，先读取已有的类型
+	if f, err = os.OpenFile(name, os.O_RDWR|os.O_APPEND, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	dec := NewDecoder(f)
+	for {
+		if _, err := dec.DecodeRow(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	enc := NewAppendEncoder(f, dec)
+	if err := enc.Encode(&TVer{"v1 again"}); err != nil {
+		t.Fatal(err)
+	}
+	{
+		type TVer struct {
+			One string
+			Two int
+		}
+		if err := enc.Encode(&TVer{"v2", 2}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewReader(bytes.NewReader(b))
+	r.FieldsPerRecord = -1
+	lines, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 5 || lines[0][2] != "TVer#1" || lines[2][0] != "v1 again" || lines[3][2] != "TVer#2" {
+		t.Fatalf("wrong lines:%#v", lines)
+	}
+	dec = NewDecoder(bytes.NewReader(b))
+	out := struct {
+		One string
+		Two int
+	}{}
+	for _, want := range []string{"v1", "v1 again", "v2"} {
+		if err := dec.Decode(&out); err != nil {
+			t.Fatal(err)
+		}
+		if out.One != want {
+			t.Fatalf("want %q,got %q", want, out.One)
+		}
+	}
+}
+
+func TestTypeVersionResolve(t *testing.T) {
+	src := "`*`\tgott\tT\tOne\n1\n`*`\tgott\tT#2\tOne\tTwo\n2\t3\n`*`\tgott\tT#1\tOne\n4\n`@`\tgott\tT\n5\t6\n"
+	dec := NewDecoder(bytes.NewBufferString(src))
+	out := struct {
+		One int
+		Two int
+	}{}
+	for _, want := range []int{1, 2, 4, 5} {
+		if err := dec.Decode(&out); err != nil {
+			t.Fatal(err)
+		}
+		if out.One != want {
+			t.Fatalf("want %d,got %d", want, out.One)
+		}
+	}
+	dec = NewDecoder(bytes.NewBufferString("`*`\tgott\tT#1\tOne\n1\n`*`\tgott\tT#1\tTwo\n2\n"))
+	if err := dec.Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if err := dec.Decode(&out); err == nil {
+		t.Fatal("redefined version must be an error")
+	}
+	dec = NewDecoder(bytes.NewBufferString("`*`\tgott\tT#x\tOne\n1\n"))
+	if err := dec.Decode(&out); !errors.Is(err, ErrTypeLine) {
+		t.Fatalf("want ErrTypeLine,got %v", err)
+	}
+}
+
+func TestQuoting(t *testing.T) {
+	buf := [][]string{{"a`b", "a^b", "x^", "^^", "#c"}, {""}, {"a^1^b^^", "`"}}
+	src := bytes.NewBuffer(nil)
+	w := NewWriter(src)
+	w.Comment = '#'
+	if err := w.WriteAll(buf); err != nil {
+		t.Fatal(err)
+	}
+	r := NewReader(src)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	if lines, err := r.ReadAll(); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(buf, lines) {
+		t.Fatalf("not equ,\n%#v\n%#v", buf, lines)
+	}
+}
+
+func TestQuotePolicy(t *testing.T) {
+	long := strings.Repeat("长", DefaultLongFieldLength+1)
+	records := [][]string{{"a", "", "b\nc", "x`y\nz", long}}
+	for _, tc := range []struct {
+		policy QuotePolicy
+		want   string
+	}{
+		{QuoteMinimal, "a\t\t`b\nc`\t^^x`y\nz^^\t" + long + "\n"},
+		{QuoteBacktick, "`a`\t``\t`b\nc`\t^^x`y\nz^^\t`" + long + "`\n"},
+		{QuoteHeredoc, "a\t\t^^b\nc^^\t^^x`y\nz^^\t" + long + "\n"},
+		{QuoteReadable, "a\t\t^^b\nc^^\t^^x`y\nz^^\t^^" + long + "^^\n"},
+	} {
+		buf := &bytes.Buffer{}
+		w := NewWriter(buf)
+		w.Quote = tc.policy
+		if err := w.WriteAll(records); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tc.want {
+			t.Fatalf("%d: not equ,\n%q\n%q", tc.policy, tc.want, buf)
+		}
+		if lines, err := NewReader(buf).ReadAll(); err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(records, lines) {
+			t.Fatalf("%d: not equ,\n%q\n%q", tc.policy, records, lines)
+		}
+	}
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.Quote, w.LongFieldLength = QuoteReadable, 3
+	if err := w.Write([]string{"abc", "abcd"}); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+	if buf.String() != "abc\t^^abcd^^\n" {
+		t.Fatalf("wrong output %q", buf)
+	}
+	//第一个字段是*或@的数据行不能被当作类型行
+	type R = struct{ A, B string }
+	values := []R{{"*", "x"}, {"@", "y"}, {"`*`", "*"}}
+	for _, policy := range []QuotePolicy{QuoteMinimal, QuoteBacktick, QuoteHeredoc, QuoteReadable} {
+		for _, dialect := range []Dialect{DialectTT, DialectRFC4180} {
+			buf := &bytes.Buffer{}
+			enc := NewEncoder(buf)
+			enc.Writer().Quote, enc.Writer().Dialect = policy, dialect
+			for i := range values {
+				if err := enc.Encode(&values[i]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			dec := NewDecoder(buf)
+			dec.Reader().Dialect = dialect
+			for i := range values {
+				v := R{}
+				if err := dec.Decode(&v); err != nil || v != values[i] {
+					t.Fatalf("%d %d: wrong value %q %v", policy, dialect, v, err)
+				}
+			}
+		}
+	}
+}
+
+func TestParseError(t *testing.T) {
+	r := NewReader(bytes.NewBufferString("a\t名称\t`b`\n`x`y\tz\nok\n^1^never"))
+	r.FieldsPerRecord = -1
+	if _, err := r.Read(); err != nil {
+		t.Fatal(err)
+	}
+	if line, col := r.FieldPos(2); line != 1 || col != 6 {
+		t.Fatalf("wrong field pos %d:%d", line, col)
+	}
+	_, err := r.Read()
+	var pe *ParseError
+	if !errors.As(err, &pe) || pe.Line != 2 || pe.Column != 4 || pe.Err != ErrQuote {
+		t.Fatalf("wrong error %v", err)
+	}
+	//出错后从下一行继续读取
+	if record, err := r.Read(); err != nil || record[0] != "ok" {
+		t.Fatalf("wrong record %v,%v", record, err)
+	}
+	if _, err := r.Read(); !errors.Is(err, ErrNotEnd) {
+		t.Fatalf("wrong error %v", err)
+	}
+}
+
+// fakeDriver 是测试用的内存数据库驱动，查询返回预设的数据，记录执行的语句
+type fakeDriver struct {
+	columns []string
+	types   []reflect.Type
+	rows    [][]driver.Value
+	queries []string
+	args    [][]driver.Value
+}
+
+func (d *fakeDriver) Connect(context.Context) (driver.Conn, error) { return d, nil }
+func (d *fakeDriver) Driver() driver.Driver                        { return nil }
+func (d *fakeDriver) Prepare(query string) (driver.Stmt, error)    { return &fakeStmt{d, query}, nil }
+func (d *fakeDriver) Close() error                                 { return nil }
+func (d *fakeDriver) Begin() (driver.Tx, error)                    { return d, nil }
+func (d *fakeDriver) Commit() error                                { return nil }
+func (d *fakeDriver) Rollback() error                              { return nil }
+
+type fakeStmt struct {
+	d     *fakeDriver
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.queries = append(s.d.queries, s.query)
+	s.d.args = append(s.d.args, args)
+	return driver.RowsAffected(1), nil
+}
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &fakeRows{d: s.d}, nil
+}
+
+type fakeRows struct {
+	d *fakeDriver
+	i int
+}
+
+func (r *fakeRows) Columns() []string                         { return r.d.columns }
+func (r *fakeRows) Close() error                              { return nil }
+func (r *fakeRows) ColumnTypeScanType(index int) reflect.Type { return r.d.types[index] }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.i >= len(r.d.rows) {
+		return io.EOF
+	}
+	copy(dest, r.d.rows[r.i])
+	r.i++
+	return nil
+}
+
+func TestSQL(t *testing.T) {
+	tm := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	d := &fakeDriver{
+		columns: []string{"id", "name", "data", "ok", "t"},
+		types: []reflect.Type{reflect.TypeOf(int64(0)), reflect.TypeOf(sql.RawBytes{}),
+			reflect.TypeOf([]byte{}), reflect.TypeOf(false), reflect.TypeOf(time.Time{})},
+		rows: [][]driver.Value{
+			{int64(1), []byte("foo\tbar"), []byte{1, 2}, true, tm},
+			{int64(2), nil, nil, false, nil},
+		},
+	}
+	db := sql.OpenDB(d)
+	defer db.Close()
+	rows, err := db.Query("SELECT * FROM src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	if err := ExportRows(NewEncoder(buf), rows); err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+	want := "`*`\tdatabase/sql\tRows#1\tid\tname\tdata,bytes=base64\tok\tt\n1\t`foo\tbar`\tAQI=\ttrue\t2020-01-02T03:04:05Z\n2\t\t\tfalse\t\n"
+	if buf.String() != want {
+		t.Fatalf("not equ,\n%q\n%q", want, buf)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := buf.String()
+	if _, err := ImportInto(NewDecoder(strings.NewReader(src)), tx, "dst;drop table x", 1); err == nil {
+		t.Fatal("want error of the table name")
+	}
+	n, err := ImportInto(NewDecoder(strings.NewReader(src)), tx, "dst", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || len(d.queries) != 2 || d.queries[0] != "INSERT INTO dst (id,name,data,ok,t) VALUES (?,?,?,?,?)" {
+		t.Fatalf("wrong insert %d %#v", n, d.queries)
+	}
+	//二进制列按字节插入
+	if !reflect.DeepEqual(d.args[0][2], []byte{1, 2}) {
+		t.Fatalf("wrong args %#v", d.args[0])
+	}
+	if !reflect.DeepEqual(d.args[1], []driver.Value{"2", nil, nil, "false", nil}) {
+		t.Fatalf("wrong args %#v", d.args[1])
+	}
+	//Decode也按照属性的选项解码
+	v := struct {
+		ID   int64     `tt:"id"`
+		Name string    `tt:"name"`
+		Data []byte    `tt:"data,bytes=hex"`
+		OK   bool      `tt:"ok"`
+		T    time.Time `tt:"t"`
+	}{}
+	dec := NewDecoder(strings.NewReader(src))
+	if err := dec.Decode(&v); err != nil || !bytes.Equal(v.Data, []byte{1, 2}) {
+		t.Fatalf("wrong value %v %v", v, err)
+	}
+}
+
+type TestNull struct {
+	S sql.NullString
+	I sql.NullInt64
+	T sql.NullTime
+	B sql.NullBool
+}
+
+func TestSQLNull(t *testing.T) {
+	data := &TestNull{
+		S: sql.NullString{String: "foo", Valid: true},
+		T: sql.NullTime{Time: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), Valid: true},
+		B: sql.NullBool{Bool: false, Valid: true},
+	}
+	buf := &bytes.Buffer{}
+	if err := NewEncoder(buf).Encode(data); err != nil {
+		t.Fatal(err)
+	}
+	out := &TestNull{I: sql.NullInt64{Int64: 3, Valid: true}}
+	if err := NewDecoder(buf).Decode(out); err != nil {
+		t.Fatal(err)
+	}
+	out.T.Time = out.T.Time.UTC()
+	if !reflect.DeepEqual(data, out) {
+		t.Fatalf("not equ,\n%#v\n%#v", data, out)
+	}
+}
+
+type TimeData struct {
+	Nano  time.Time
+	Unix  time.Time `tt:",time=unix"`
+	Milli time.Time `tt:",time=unixmilli"`
+	Day   time.Time `tt:",time=2006-01-02"`
+	Wait  time.Duration
+}
+
+func TestTimeFormat(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	tm := time.Date(2020, 1, 2, 3, 4, 5, 123456789, loc)
+	data := &TimeData{tm, tm, tm, tm, 90*time.Minute + time.Nanosecond}
+	buf := &bytes.Buffer{}
+	if err := NewEncoder(buf).Encode(data); err != nil {
+		t.Fatal(err)
+	}
+	want := "2020-01-02T03:04:05.123456789+08:00\t1577905445\t1577905445123\t2020-01-02\t1h30m0.000000001s\n"
+	if s := buf.String(); !strings.HasSuffix(s, want) {
+		t.Fatalf("not equ,\n%q\n%q", want, s)
+	}
+	dec := NewDecoder(buf)
+	dec.Location = loc
+	out := &TimeData{}
+	if err := dec.Decode(out); err != nil {
+		t.Fatal(err)
+	}
+	if !out.Nano.Equal(tm) || !out.Unix.Equal(tm.Truncate(time.Second)) ||
+		!out.Milli.Equal(tm.Truncate(time.Millisecond)) || out.Wait != data.Wait {
+		t.Fatalf("not equ,\n%#v\n%#v", data, out)
+	}
+	if out.Day != time.Date(2020, 1, 2, 0, 0, 0, 0, loc) || out.Unix.Location() != loc {
+		t.Fatalf("wrong location %v %v", out.Day, out.Unix)
+	}
+	enc := NewEncoder(buf)
+	enc.TimeFormat = TimeUnixNano
+	enc.Location = time.UTC
+	if err := enc.Encode(&struct{ T time.Time }{tm}); err != nil {
+		t.Fatal(err)
+	}
+	if s := buf.String(); !strings.HasSuffix(s, "\n1577905445123456789\n") {
+		t.Fatalf("wrong unixnano %q", s)
+	}
+}
+
+type BytesData struct {
+	Std  []byte
+	Hex  [4]byte `tt:",bytes=hex"`
+	URL  []byte  `tt:",bytes=base64url"`
+	B32  []byte  `tt:",bytes=base32"`
+	Text []byte  `tt:",bytes=raw"`
+	Null []byte
+}
+
+func TestBytesFormat(t *testing.T) {
+	data := &BytesData{
+		Std:  []byte{0xfb, 0xff},
+		Hex:  [4]byte{0xde, 0xad, 0xbe, 0xef},
+		URL:  []byte{0xfb, 0xff},
+		B32:  []byte("foo"),
+		Text: []byte("多行\n`文本`^^"),
+	}
+	buf := &bytes.Buffer{}
+	if err := NewEncoder(buf).Encode(data); err != nil {
+		t.Fatal(err)
+	}
+	want := "\n+/8=\tdeadbeef\t-_8\tMZXW6===\t^1^多行\n`文本`^^^1^\t\n"
+	if s := buf.String(); !strings.HasSuffix(s, want) {
+		t.Fatalf("not equ,\n%q\n%q", want, s)
+	}
+	out := &BytesData{Null: []byte{1}}
+	if err := NewDecoder(buf).Decode(out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(data, out) {
+		t.Fatalf("not equ,\n%#v\n%#v", data, out)
+	}
+	if err := NewEncoder(buf).Encode(&BytesData{Text: []byte{0xff}}); err == nil {
+		t.Fatal("invalid text must be an error")
+	}
+	dec := NewDecoder(bytes.NewBufferString("`*`\tgott\tBytesData#1\tHex\ndead\n"))
+	if err := dec.Decode(out); err == nil {
+		t.Fatal("wrong array length must be an error")
+	}
+}
+
+type NumberData struct {
+	F32   float32
+	Big   float64
+	Fixed float64 `tt:",float=f2"`
+	NaN   float64
+	Inf   float64
+	Int   *big.Int
+	Float *big.Float
+	Dec   *big.Rat
+	Third *big.Rat
+	Null  *big.Int
+}
+
+func TestNumberFormat(t *testing.T) {
+	i, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	f, _, _ := big.ParseFloat("3.14159265358979323846264338327950288", 10, 200, big.ToNearestEven)
+	data := &NumberData{
+		F32:   1.1,
+		Big:   1e21,
+		Fixed: 3.14159,
+		NaN:   math.NaN(),
+		Inf:   math.Inf(-1),
+		Int:   i,
+		Float: f,
+		Dec:   big.NewRat(-12345, 100),
+		Third: big.NewRat(1, 3),
+	}
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	enc.FloatFormat = "f"
+	if err := enc.Encode(data); err != nil {
+		t.Fatal(err)
+	}
+	want := "\n1.1\t1000000000000000000000\t3.14\tNaN\t-Inf\t123456789012345678901234567890\t" +
+		"3.14159265358979323846264338327950288\t-123.45\t1/3\t\n"
+	if s := buf.String(); !strings.HasSuffix(s, want) {
+		t.Fatalf("not equ,\n%q\n%q", want, s)
+	}
+	out := &NumberData{Null: big.NewInt(1), Float: new(big.Float).SetPrec(200)}
+	if err := NewDecoder(buf).Decode(out); err != nil {
+		t.Fatal(err)
+	}
+	if out.F32 != data.F32 || out.Big != data.Big || out.Fixed != 3.14 || !math.IsNaN(out.NaN) ||
+		!math.IsInf(out.Inf, -1) || out.Int.Cmp(i) != 0 || out.Float.Cmp(f) != 0 ||
+		out.Dec.Cmp(data.Dec) != 0 || out.Third.Cmp(data.Third) != 0 || out.Null != nil {
+		t.Fatalf("not equ,\n%#v\n%#v", data, out)
+	}
+}
+
+func TestCharset(t *testing.T) {
+	records := [][]string{{"名称", "年龄"}, {"张三", "多行\n文本"}}
+	for _, enc := range []encoding.Encoding{nil, unicode.UTF8, simplifiedchinese.GB18030,
+		unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)} {
+		buf := &bytes.Buffer{}
+		w := NewWriter(buf)
+		w.Encoding = enc
+		w.BOM = true
+		if err := w.WriteAll(records); err != nil {
+			t.Fatal(err)
+		}
+		if enc != nil && enc != unicode.UTF8 && bytes.Contains(buf.Bytes(), []byte("名称")) {
+			t.Fatalf("%v not transcoded", enc)
+		}
+		//根据字节顺序标记自动识别
+		if lines, err := NewReader(bytes.NewReader(buf.Bytes())).ReadAll(); err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(records, lines) {
+			t.Fatalf("%v not equ,\n%#v\n%#v", enc, records, lines)
+		}
+	}
+	//没有字节顺序标记时需要指定字符集
+	gbk, _ := simplifiedchinese.GB18030.NewEncoder().String("`*`\tgott\tT#1\tT名称\n张三\n")
+	dec := NewDecoder(bytes.NewBufferString(gbk))
+	dec.Reader().Encoding = simplifiedchinese.GB18030
+	out := struct{ T名称 string }{}
+	if err := dec.Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out.T名称 != "张三" {
+		t.Fatalf("wrong value %q", out.T名称)
+	}
+}
+
+func TestInvalidUTF8(t *testing.T) {
+	src := "a\xffb\t`c\xfe`\n^^d\ne\xff^^\tf\n"
+	//默认保留原始字节
+	lines, err := NewReader(strings.NewReader(src)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]string{{"a\xffb", "c\xfe"}, {"d\ne\xff", "f"}}; !reflect.DeepEqual(want, lines) {
+		t.Fatalf("not equ,\n%q\n%q", want, lines)
+	}
+	buf := &bytes.Buffer{}
+	if err := NewWriter(buf).WriteAll(lines); err != nil {
+		t.Fatal(err)
+	}
+	if back, _ := NewReader(buf).ReadAll(); !reflect.DeepEqual(lines, back) {
+		t.Fatalf("not equ,\n%q\n%q", lines, back)
+	}
+	r := NewReader(strings.NewReader(src))
+	r.InvalidUTF8 = UTF8Replace
+	if lines, err = r.ReadAll(); err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]string{{"a�b", "c�"}, {"d\ne�", "f"}}; !reflect.DeepEqual(want, lines) {
+		t.Fatalf("not equ,\n%q\n%q", want, lines)
+	}
+	for _, tc := range []struct {
+		src          string
+		line, column int
+	}{
+		{"a\xffb\n", 1, 2},
+		{"x\t`c\xfe`\n", 1, 5},
+		{"^^d\ne\xff^^\n", 2, 2},
+	} {
+		r := NewReader(strings.NewReader(tc.src))
+		r.InvalidUTF8 = UTF8Error
+		_, err := r.Read()
+		pe, ok := err.(*ParseError)
+		if !ok || !errors.Is(err, ErrInvalidUTF8) || pe.Line != tc.line || pe.Column != tc.column {
+			t.Fatalf("%q: wrong error %v", tc.src, err)
+		}
+	}
+	w := NewWriter(&bytes.Buffer{})
+	w.InvalidUTF8 = UTF8Error
+	if err := w.Write([]string{"ok", "x\xff"}); !errors.Is(err, ErrInvalidUTF8) {
+		t.Fatalf("wrong error %v", err)
+	}
+	buf.Reset()
+	w = NewWriter(buf)
+	w.InvalidUTF8 = UTF8Replace
+	w.Write([]string{"x\xff"})
+	w.Flush()
+	if buf.String() != "x�\n" {
+		t.Fatalf("wrong output %q", buf)
+	}
+}
+
+func TestPretty(t *testing.T) {
+	records := [][]string{{"名称", "code", "note"}, {"张三", "a", "x"}, {"Bob", "bb ", "多行\n文本"}, {"c", "d"}}
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.Comment = '#'
+	w.Pretty = true
+	w.Write(records[0])
+	w.WriteComment("注释")
+	if err := w.WriteAll(records[1:]); err != nil {
+		t.Fatal(err)
+	}
+	want := "名称\tcode\tnote\n#注释\n" +
+		"张三\ta    \tx\n" +
+		"Bob \t`bb `\t`多行\n文本`\n" +
+		"c\td\n"
+	if buf.String() != want {
+		t.Fatalf("not equ,\n%s\n%s", want, buf)
+	}
+	r := NewReader(buf)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimPadding = true
+	if lines, err := r.ReadAll(); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(records, lines) {
+		t.Fatalf("not equ,\n%q\n%q", records, lines)
+	}
+	//编码器在美化输出时不逐行刷新
+	buf.Reset()
+	enc := NewEncoder(buf)
+	enc.Writer().Pretty = true
+	for _, v := range []interface{}{&struct{ T名称, Code string }{"张三", "a"}, &struct{ T名称, Code string }{"Bob", "bbb"}} {
+		if err := enc.Encode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("flushed before Flush: %q", buf)
+	}
+	if err := enc.Writer().Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if want := "`*`\t\t#1\tT名称\tCode\n张三\ta\nBob \tbbb\n"; buf.String() != want {
+		t.Fatalf("not equ,\n%q\n%q", want, buf)
+	}
+}
+
+func TestDialect(t *testing.T) {
+	records := [][]string{{"a`b", "say \"hi\"", "^^"}, {"多行\n文本", "x\ty", ""}}
+	for _, tc := range []struct {
+		dialect Dialect
+		want    string
+	}{
+		{DialectTT, "^^a`b^^\tsay \"hi\"\t`^^`\n`多行\n文本`\t`x\ty`\t\n"},
+		{DialectRFC4180, "a`b\t\"say \"\"hi\"\"\"\t^^\n\"多行\n文本\"\t\"x\ty\"\t\n"},
+		{DialectExcel, "a`b\t\"say \"\"hi\"\"\"\t^^\r\n\"多行\n文本\"\t\"x\ty\"\t\r\n"},
+	} {
+		buf := &bytes.Buffer{}
+		w := NewWriter(buf)
+		w.Dialect = tc.dialect
+		if err := w.WriteAll(records); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tc.want {
+			t.Fatalf("%d: not equ,\n%q\n%q", tc.dialect, tc.want, buf)
+		}
+		r := NewReader(buf)
+		r.Dialect = tc.dialect
+		if lines, err := r.ReadAll(); err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(records, lines) {
+			t.Fatalf("%d: not equ,\n%q\n%q", tc.dialect, records, lines)
+		}
+	}
+	//Excel把不在字段边界的"当作普通字符
+	r := NewReader(strings.NewReader("5\"\t\"a\"b\"\t\"\"\"c\"\"\"\r\n"))
+	r.Dialect = DialectExcel
+	if line, err := r.Read(); err != nil {
+		t.Fatal(err)
+	} else if want := []string{"5\"", "a\"b", "\"c\""}; !reflect.DeepEqual(want, line) {
+		t.Fatalf("not equ,\n%q\n%q", want, line)
+	}
+	for _, tc := range []struct {
+		src    string
+		err    error
+		column int
+	}{
+		{"5\"\n", ErrBareQuote, 2},
+		{"\"a\"b\n", ErrDoubleQuote, 4},
+		{"x\t\"a\n", ErrNotEnd, 3},
+	} {
+		r := NewReader(strings.NewReader(tc.src))
+		r.Dialect = DialectRFC4180
+		_, err := r.Read()
+		if pe, ok := err.(*ParseError); !ok || pe.Err != tc.err || pe.Column != tc.column {
+			t.Fatalf("%q: wrong error %v", tc.src, err)
+		}
+	}
+	//类型化文件也可以使用其他方言
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	enc.Writer().Dialect = DialectRFC4180
+	enc.Writer().Comma = ','
+	in := struct{ A, B string }{"1,2", "\"x\""}
+	if err := enc.Encode(&in); err != nil {
+		t.Fatal(err)
+	}
+	dec := NewDecoder(buf)
+	dec.Reader().Dialect = DialectRFC4180
+	dec.Reader().Comma = ','
+	out := struct{ A, B string }{}
+	if err := dec.Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if in != out {
+		t.Fatalf("not equ,\n%#v\n%#v", in, out)
+	}
+}
+
+func TestSeparator(t *testing.T) {
+	records := [][]string{{"a\nb", "c\x1fd", "e\x1e"}, {"", "x|", "|"}}
+	for _, tc := range []struct {
+		delimiter, terminator string
+		want                  string
+	}{
+		{"\x1f", "\x1e", "a\nb\x1f`c\x1fd`\x1f`e\x1e`\x1e\x1fx|\x1f|\x1e"},
+		{"||", "\r\n", "a\nb||c\x1fd||e\x1e\r\n||`x|`||`|`\r\n"},
+	} {
+		buf := &bytes.Buffer{}
+		w := NewWriter(buf)
+		w.Delimiter, w.Terminator = tc.delimiter, tc.terminator
+		if err := w.WriteAll(records); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tc.want {
+			t.Fatalf("%q: not equ,\n%q\n%q", tc.delimiter, tc.want, buf)
+		}
+		r := NewReader(buf)
+		r.Delimiter, r.Terminator = tc.delimiter, tc.terminator
+		if lines, err := r.ReadAll(); err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(records, lines) {
+			t.Fatalf("%q: not equ,\n%q\n%q", tc.delimiter, records, lines)
+		}
+	}
+	//双引号方言和\r\n结束的输出
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.Dialect = DialectRFC4180
+	w.Delimiter, w.Terminator = ", ", "\r\n"
+	if err := w.WriteAll([][]string{{"a,b", "c, d", "e\nf"}}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "a,b, \"c, d\", e\nf\r\n"; buf.String() != want {
+		t.Fatalf("not equ,\n%q\n%q", want, buf)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	huge := strings.Repeat("x", 1<<16)
+	for _, tc := range []struct {
+		src          string
+		set          func(r *Reader)
+		err          error
+		line, column int
+	}{
+		{"ab\tc\nabcdef\tg\n", func(r *Reader) { r.MaxFieldBytes = 4 }, ErrFieldTooLong, 2, 1},
+		{"a\t`" + huge + "`\n", func(r *Reader) { r.MaxFieldBytes = 1024 }, ErrFieldTooLong, 1, 3},
+		{"a\t^1^" + huge + "^1^\n", func(r *Reader) { r.MaxFieldBytes = 1024 }, ErrFieldTooLong, 1, 3},
+		{"a\t\"" + huge + "\"\n", func(r *Reader) { r.MaxFieldBytes = 1024; r.Dialect = DialectRFC4180 }, ErrFieldTooLong, 1, 3},
+		{"abc\tdef\tghi\n", func(r *Reader) { r.MaxRecordBytes = 6 }, ErrRecordTooLong, 1, 5},
+		{"#" + huge + "\n", func(r *Reader) { r.Comment = '#'; r.MaxRecordBytes = 1024 }, ErrRecordTooLong, 1, 1},
+		{"a\tb\tc\n", func(r *Reader) { r.MaxFieldsPerRecord = 2 }, ErrTooManyFields, 1, 5},
+		{strings.Repeat("\t", 100000) + "\n", func(r *Reader) { r.MaxRecordBytes = 100; r.MaxFieldBytes = 10 }, ErrRecordTooLong, 1, 101},
+	} {
+		r := NewReader(strings.NewReader(tc.src))
+		r.FieldsPerRecord = -1
+		tc.set(r)
+		var err error
+		for err == nil {
+			_, err = r.Read()
+		}
+		pe, ok := err.(*ParseError)
+		if !ok || pe.Err != tc.err || pe.Line != tc.line || pe.Column != tc.column {
+			t.Fatalf("%.20q: wrong error %v", tc.src, err)
+		}
+		//跳过出错的行后继续读取
+		if tc.line == 1 {
+			r := NewReader(strings.NewReader(tc.src + "ok\n"))
+			tc.set(r)
+			if _, err := r.Read(); !errors.Is(err, tc.err) {
+				t.Fatalf("%.20q: wrong error %v", tc.src, err)
+			}
+			if line, err := r.Read(); err != nil || line[0] != "ok" {
+				t.Fatalf("%.20q: wrong line %q %v", tc.src, line, err)
+			}
+		}
+	}
+	src := "`*`\tgott\tA#1\tX\n1\n`*`\tgott\tB#1\tX\n2\n"
+	dec := NewDecoder(strings.NewReader(src))
+	dec.MaxTypes = 1
+	v := struct{ X string }{}
+	if err := dec.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	err := dec.Decode(&v)
+	if pe, ok := err.(*ParseError); !ok || pe.Err != ErrTooManyTypes || pe.Line != 3 {
+		t.Fatalf("wrong error %v", err)
+	}
+}
+
+func TestContext(t *testing.T) {
+	pr, pw := io.Pipe()
+	go pw.Write([]byte("a\tb\nc\t"))
+	r := NewReader(pr)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if line, err := r.ReadContext(ctx); err != nil || line[0] != "a" {
+		t.Fatalf("wrong line %q %v", line, err)
+	}
+	//第二行没有写完，读取阻塞到超时
+	_, err := r.ReadContext(ctx)
+	pe, ok := err.(*ParseError)
+	if !ok || !errors.Is(err, context.DeadlineExceeded) || pe.Line != 2 || pe.Column != 1 {
+		t.Fatalf("wrong error %v", err)
+	}
+	//放弃的读取由下一次调用返回
+	go func() {
+		pw.Write([]byte("d\ne\tf\n"))
+		pw.Close()
+	}()
+	lines, err := r.ReadAllContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]string{{"c", "d"}, {"e", "f"}}; !reflect.DeepEqual(want, lines) {
+		t.Fatalf("not equ,\n%q\n%q", want, lines)
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	dec := NewDecoder(strings.NewReader("`*`\tgott\tT#1\tOne\n1\n"))
+	out := struct{ One string }{}
+	if err := dec.DecodeContext(canceled, &out); !errors.Is(err, context.Canceled) {
+		t.Fatalf("wrong error %v", err)
+	}
+	if err := dec.DecodeContext(context.Background(), &out); err != nil || out.One != "1" {
+		t.Fatalf("wrong value %q %v", out.One, err)
+	}
+
+	pr, pw = io.Pipe()
+	enc := NewEncoder(pw)
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := enc.EncodeContext(ctx, &out); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wrong error %v", err)
+	}
+	//读取后，放弃的写入完成，下一次写入继续
+	go func() {
+		enc.Encode(&out)
+		pw.Close()
+	}()
+	if b, _ := io.ReadAll(pr); string(b) != "`*`\t\t#1\tOne\n1\n1\n" {
+		t.Fatalf("wrong output %q", b)
+	}
+}
+
+func TestSyncEncoder(t *testing.T) {
+	type A struct{ Producer, Seq int }
+	type B struct{ Name string }
+	const producers, records = 8, 200
+	for _, queued := range []bool{false, true} {
+		buf := &bytes.Buffer{}
+		enc := NewSyncEncoder(buf)
+		if queued {
+			enc = NewQueuedEncoder(buf, 16)
+		}
+		errs := make(chan error, producers)
+		for p := 0; p < producers; p++ {
+			go func(p int) {
+				var err error
+				for i := 0; i < records && err == nil; i++ {
+					if i%3 == 0 {
+						err = enc.Encode(&B{fmt.Sprintf("p%d", p)})
+					} else {
+						err = enc.Encode(&A{p, i})
+					}
+				}
+				errs <- err
+			}(p)
+		}
+		for p := 0; p < producers; p++ {
+			if err := <-errs; err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := enc.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := enc.Encode(&B{}); err != ErrEncoderClosed {
+			t.Fatalf("wrong error %v", err)
+		}
+		//每个生产者的记录完整且有序
+		dec := NewDecoder(buf)
+		last := make([]int, producers)
+		n := 0
+		for {
+			row, err := dec.DecodeRow()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if row.Name == "A" {
+				a := A{}
+				fmt.Sscan(row.Values[0], &a.Producer)
+				fmt.Sscan(row.Values[1], &a.Seq)
+				if a.Seq <= last[a.Producer] {
+					t.Fatalf("out of order %v", a)
+				}
+				last[a.Producer] = a.Seq
+			}
+			n++
+		}
+		if n != producers*records {
+			t.Fatalf("want %d records, got %d", producers*records, n)
+		}
+	}
+}
+
+func TestRotatingEncoder(t *testing.T) {
+	dir := t.TempDir()
+	pattern := dir + "/log-%03d.tt"
+	//已有的文件不会被覆盖
+	if err := os.WriteFile(fmt.Sprintf(pattern, 2), []byte("old"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range []string{dir + "/log.tt", dir + "/%d-%d.tt", dir + "/100%%.tt"} {
+		if _, err := NewRotatingEncoder(bad); err == nil {
+			t.Fatalf("want error of pattern %q", bad)
+		}
+	}
+	enc, err := NewRotatingEncoder(pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc.MaxRecords = 2
+	for i := 0; i < 5; i++ {
+		row := &Row{PkgPath: "gott", Name: "E", Columns: []string{"One"}, Values: []string{fmt.Sprint(i)}}
+		if i == 3 {
+			//属性变化，注册新版本
+			row.Columns, row.Values = []string{"One", "Two"}, []string{"v2", "x"}
+		}
+		if err := enc.EncodeRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]string{
+		1: "`*`\tgott\tE#1\tOne\n0\n1\n",
+		2: "old",
+		3: "`*`\tgott\tE#1\tOne\n2\n`*`\tgott\tE#2\tOne\tTwo\nv2\tx\n",
+		4: "`*`\tgott\tE#1\tOne\n4\n",
+	}
+	for n, content := range want {
+		if b, err := os.ReadFile(fmt.Sprintf(pattern, n)); err != nil || string(b) != content {
+			t.Fatalf("file %d: wrong content %q %v", n, b, err)
+		}
+	}
+	//按字节数和时间切换
+	now := time.Now()
+	if enc, err = NewRotatingEncoder(dir + "/t-%d.tt"); err != nil {
+		t.Fatal(err)
+	}
+	enc.MaxBytes = 30
+	enc.Interval = time.Hour
+	enc.now = func() time.Time { return now }
+	names := []string{}
+	for i := 0; i < 4; i++ {
+		if i == 3 {
+			now = now.Add(time.Hour)
+		}
+		if err := enc.Encode(&struct{ One string }{"0123456789"}); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, enc.Name())
+	}
+	enc.Close()
+	if want := []string{dir + "/t-1.tt", dir + "/t-1.tt", dir + "/t-2.tt", dir + "/t-3.tt"}; !reflect.DeepEqual(want, names) {
+		t.Fatalf("not equ,\n%q\n%q", want, names)
+	}
+	//美化输出时缓存的记录也计入字节数
+	if enc, err = NewRotatingEncoder(dir + "/p-%d.tt"); err != nil {
+		t.Fatal(err)
+	}
+	enc.MaxBytes = 30
+	enc.Setup = func(e *Encoder) { e.Writer().Pretty = true }
+	names = names[:0]
+	for i := 0; i < 3; i++ {
+		if err := enc.Encode(&struct{ One string }{"0123456789"}); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, enc.Name())
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{dir + "/p-1.tt", dir + "/p-1.tt", dir + "/p-2.tt"}; !reflect.DeepEqual(want, names) {
+		t.Fatalf("not equ,\n%q\n%q", want, names)
+	}
+	if b, err := os.ReadFile(dir + "/p-2.tt"); err != nil || string(b) != "`*`\t\t#1\tOne\n0123456789\n" {
+		t.Fatalf("wrong content %q %v", b, err)
+	}
+}
+
+func TestFollow(t *testing.T) {
+	name := t.TempDir() + "/follow.tt"
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.WriteString("`*`\tgott\tT#1\tOne\tTwo\n1\t^^a\n")
+	fl, err := Follow(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fl.Poll = time.Millisecond
+	rows := make(chan *Row)
+	errs := make(chan error, 1)
+	go func() {
+		for {
+			row, err := fl.DecodeRow()
+			if err != nil {
+				errs <- err
+				return
+			}
+			rows <- row
+		}
+	}()
+	next := func() []string {
+		select {
+		case row := <-rows:
+			return row.Values
+		case err := <-errs:
+			t.Fatal(err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout")
+		}
+		return nil
+	}
+	//多行字段没有结束前不返回
+	select {
+	case row := <-rows:
+		t.Fatalf("half-written record %q", row.Values)
+	case <-time.After(20 * time.Millisecond):
+	}
+	f.WriteString("b^^\n2\t")
+	if v := next(); !reflect.DeepEqual(v, []string{"1", "a\nb"}) {
+		t.Fatalf("wrong record %q", v)
+	}
+	f.WriteString("c\n")
+	if v := next(); !reflect.DeepEqual(v, []string{"2", "c"}) {
+		t.Fatalf("wrong record %q", v)
+	}
+	//轮换到新文件
+	if err := os.Rename(name, name+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte("`*`\tgott\tT#1\tOne\tTwo\n3\td\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if v := next(); !reflect.DeepEqual(v, []string{"3", "d"}) {
+		t.Fatalf("wrong record %q", v)
+	}
+	//截断
+	if err := os.WriteFile(name, []byte("`*`\tgott\tU#1\tX\n4\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if v := next(); !reflect.DeepEqual(v, []string{"4"}) {
+		t.Fatalf("wrong record %q", v)
+	}
+	fl.Close()
+	if err := <-errs; !errors.Is(err, ErrFollowerClosed) {
+		t.Fatalf("wrong error %v", err)
+	}
+}
+
+func TestFollowShort(t *testing.T) {
+	for _, dialect := range []Dialect{DialectTT, DialectExcel} {
+		name := t.TempDir() + "/short.tt"
+		if err := os.WriteFile(name, []byte("1234\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		fl, err := Follow(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fl.Poll = time.Millisecond
+		fl.Decoder().Reader().Dialect = dialect
+		records := make(chan []string)
+		go func() {
+			for {
+				record, err := fl.Read()
+				if err != nil {
+					close(records)
+					return
+				}
+				records <- record
+			}
+		}()
+		next := func() []string {
+			select {
+			case record := <-records:
+				return record
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timeout of dialect %v", dialect)
+			}
+			return nil
+		}
+		//短于字节顺序标记和预读长度的记录也能返回
+		if v := next(); !reflect.DeepEqual(v, []string{"1234"}) {
+			t.Fatalf("wrong record %q", v)
+		}
+		//截断后重新检查字节顺序标记
+		if err := os.WriteFile(name, []byte("\"3\"\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		want := []string{`"3"`}
+		if dialect == DialectExcel {
+			want = []string{"3"}
+		}
+		if v := next(); !reflect.DeepEqual(v, want) {
+			t.Fatalf("wrong record %q", v)
+		}
+		fl.Close()
+		for range records {
+		}
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	src := "`*`\tgott\tT#1\tOne\n1\n^^2\n2^^\n`*`\tgott\tU#1\tX\tY\nx\ty\n`@`\tgott\tT#1\n3\n`x`y\n"
+	dec := NewDecoder(strings.NewReader(src))
+	for i := 0; i < 2; i++ {
+		if _, err := dec.DecodeRow(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	token, err := dec.Checkpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	//从断点继续读取，结果和不中断时相同
+	dec, err = ResumeDecoder(strings.NewReader(src), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range [][]string{{"x", "y"}, {"3"}} {
+		row, err := dec.DecodeRow()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(want, row.Values) {
+			t.Fatalf("not equ,\n%q\n%q", want, row.Values)
+		}
+	}
+	_, err = dec.DecodeRow()
+	if pe, ok := err.(*ParseError); !ok || pe.Line != 9 || pe.Column != 4 {
+		t.Fatalf("wrong error %v", err)
+	}
+	//恢复后记录的序号继续原来的编号
+	src = "`*`\tgott\tValidData#1\tName\tCount\tState\tCode\nabc\t1\tnew\tAB\n\t11\tdone\tabc\n"
+	dec = NewDecoder(strings.NewReader(src))
+	if err := dec.Decode(&ValidData{}); err != nil {
+		t.Fatal(err)
+	}
+	if token, err = dec.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	if dec, err = ResumeDecoder(strings.NewReader(src), token); err != nil {
+		t.Fatal(err)
+	}
+	var errs ValidationErrors
+	if err := dec.Decode(&ValidData{}); !errors.As(err, &errs) || errs[0].Record != 2 || errs[0].Line != 3 {
+		t.Fatalf("wrong error %v", err)
+	}
+
+	r := NewReader(strings.NewReader("\ufeffa\tb\nc\td\ne\n"))
+	if _, err := r.Read(); err != nil {
+		t.Fatal(err)
+	}
+	if token, err = r.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	if r, err = ResumeReader(strings.NewReader("\ufeffa\tb\nc\td\ne\n"), token); err != nil {
+		t.Fatal(err)
+	}
+	if line, err := r.Read(); err != nil || line[0] != "c" {
+		t.Fatalf("wrong line %q %v", line, err)
+	}
+	if _, err := r.Read(); !errors.Is(err, ErrFieldCount) {
+		t.Fatalf("wrong error %v", err)
+	}
+	r = NewReader(strings.NewReader("a\n"))
+	r.Encoding = simplifiedchinese.GB18030
+	if _, err := r.Checkpoint(); err == nil {
+		t.Fatal("checkpoint of transcoded input must be an error")
+	}
+}
+
+func TestPatch(t *testing.T) {
+	type P struct {
+		ID    int `tt:",key"`
+		Name  string
+		Note  string
+		Count int
+	}
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	if err := enc.EncodePatch(&P{}, &P{}); err == nil {
+		t.Fatal("want error without the Absent marker")
+	}
+	enc.Absent = "-"
+	base := P{1, "a", "x", 1}
+	if err := enc.EncodePatch(&P{1, "b", "x", 1}, &base); err != nil {
+		t.Fatal(err)
+	}
+	//和缺失标记相同的值需要引用
+	if err := enc.EncodePatch(&P{1, "b", "-", 1}, &base); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Encode(&P{2, "-", "", 0}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(buf.String(), "\n")
+	if lines[1] != "1\tb\t-\t-" || lines[2] != "1\tb\t`-`\t-" || lines[3] != "2\t`-`\t\t0" {
+		t.Fatalf("wrong patch %q", lines)
+	}
+	dec := NewDecoder(strings.NewReader(buf.String()))
+	dec.Absent = "-"
+	v := base
+	if err := dec.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v != (P{1, "b", "x", 1}) {
+		t.Fatalf("wrong value %v", v)
+	}
+	if err := dec.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v != (P{1, "b", "-", 1}) {
+		t.Fatalf("wrong value %v", v)
+	}
+	//缺少的列保持原值
+	dec = NewDecoder(strings.NewReader("`*`\tx\tP#1\tID\tCount\n2\t-\n"))
+	dec.Absent = "-"
+	v = base
+	if err := dec.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v != (P{2, "a", "x", 1}) {
+		t.Fatalf("wrong value %v", v)
+	}
+	//不引用时不能原样读回的缺失标记
+	for _, marker := range []string{"a\tb", "x\ny", "`x", "^x", "a`b", "*", "@", "#c"} {
+		enc = NewEncoder(&bytes.Buffer{})
+		enc.Absent = marker
+		enc.Writer().Comment = '#'
+		if err := enc.EncodePatch(&P{}, &P{}); err == nil {
+			t.Fatalf("want error of marker %q", marker)
+		}
+		dec = NewDecoder(strings.NewReader("`*`\tx\tP#1\tID\n1\n"))
+		dec.Absent = marker
+		dec.Reader().Comment = '#'
+		if err := dec.Decode(&P{}); err == nil {
+			t.Fatalf("want error of marker %q", marker)
+		}
+	}
+	//基准值只读取，不调用BeforeEncodeTT
+	enc = NewEncoder(&bytes.Buffer{})
+	enc.Absent = "-"
+	hb := HookData{"a", 2, 3, 6}
+	if err := enc.EncodePatch(&HookData{"a", 2, 4, 8}, &hb); err != nil {
+		t.Fatal(err)
+	}
+	if hb.Total != 6 {
+		t.Fatalf("base changed %v", hb)
+	}
+}
+
+type ValidData struct {
+	Name  string `tt:",required,len=3"`
+	Count int    `tt:",min=1,max=10"`
+	State string `tt:",oneof=new open"`
+	Code  string `tt:",regexp=^[A-Z]{1,2}$"`
+}
+
+func (v *ValidData) Validate() error {
+	if v.State == "open" && v.Count < 5 {
+		return fmt.Errorf("open with count %d", v.Count)
+	}
+	return nil
+}
+
+func TestValidate(t *testing.T) {
+	src := "`*`\tgott\tValidData#1\tName\tCount\tState\tCode\n" +
+		"abc\t1\tnew\tAB\n" +
+		"\t11\tdone\tabc\n" +
+		"abc\t2\topen\tA\n"
+	dec := NewDecoder(strings.NewReader(src))
+	var all ValidationErrors
+	n := 0
+	for {
+		v := ValidData{}
+		err := dec.Decode(&v)
+		if err == io.EOF {
+			break
+		}
+		var errs ValidationErrors
+		if errors.As(err, &errs) {
+			all = append(all, errs...)
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		n++
+	}
+	if n != 3 || len(all) != 5 {
+		t.Fatalf("wrong errors %d %v", n, all)
+	}
+	want := []struct {
+		record, line int
+		field        string
+		err          error
+	}{
+		{2, 3, "Name", ErrRequired},
+		{2, 3, "Count", ErrMax},
+		{2, 3, "State", ErrOneOf},
+		{2, 3, "Code", ErrRegexp},
+		{3, 4, "", nil},
+	}
+	for i, w := range want {
+		e := all[i]
+		if e.Record != w.record || e.Line != w.line || e.Field != w.field || w.err != nil && !errors.Is(e, w.err) {
+			t.Errorf("wrong error %d: %v", i, e)
+		}
+	}
+	if !errors.Is(all, ErrOneOf) {
+		t.Error("ValidationErrors doesn't unwrap")
+	}
+	//标签错误
+	type Bad struct {
+		N bool `tt:",min=1"`
+	}
+	dec = NewDecoder(strings.NewReader("`*`\t\t#1\tN\ntrue\n"))
+	var errs ValidationErrors
+	if err := dec.Decode(&Bad{}); err == nil || errors.As(err, &errs) {
+		t.Fatalf("wrong error %v", err)
+	}
+	//没有约束的属性不检查，包括调用者预先设置的接口属性
+	type E = struct {
+		N   int
+		Ext interface{}
+	}
+	dec = NewDecoder(strings.NewReader("`*`\t\t#1\tN\n1\n"))
+	e := E{Ext: map[string]int{"a": 1}}
+	if err := dec.Decode(&e); err != nil || e.N != 1 {
+		t.Fatalf("wrong value %v %v", e, err)
+	}
+}
+
+type HookData struct {
+	Name  string
+	Price int
+	Qty   int
+	Total int
+}
+
+func (h *HookData) BeforeEncodeTT() error {
+	h.Total = 0
+	return nil
+}
+
+func (h *HookData) AfterDecodeTT() error {
+	h.Total = h.Price * h.Qty
+	return nil
+}
+
+func TestHooks(t *testing.T) {
+	var calls []string
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	enc.FieldHooks = []FieldHook{
+		func(tp reflect.Type, field, value string) (string, error) {
+			calls = append(calls, tp.Name()+"."+field)
+			return strings.TrimSpace(value), nil
+		},
+		func(tp reflect.Type, field, value string) (string, error) {
+			if field == "Name" {
+				return strings.ToUpper(value), nil
+			}
+			return value, nil
+		},
+	}
+	if err := enc.Encode(&HookData{" ab ", 2, 3, 100}); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 4 || calls[0] != "HookData.Name" {
+		t.Fatalf("wrong calls %v", calls)
+	}
+	lines := strings.Split(buf.String(), "\n")
+	if lines[1] != "AB\t2\t3\t0" {
+		t.Fatalf("wrong line %q", lines[1])
+	}
+	dec := NewDecoder(buf)
+	dec.FieldHooks = []FieldHook{
+		func(tp reflect.Type, field, value string) (string, error) {
+			if field == "Name" {
+				return strings.ToLower(value), nil
+			}
+			return value, nil
+		},
+	}
+	v := HookData{}
+	if err := dec.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v != (HookData{"ab", 2, 3, 6}) {
+		t.Fatalf("wrong value %v", v)
+	}
+	//钩子的错误
+	enc.FieldHooks = []FieldHook{func(reflect.Type, string, string) (string, error) {
+		return "", ErrRequired
+	}}
+	if err := enc.Encode(&HookData{}); !errors.Is(err, ErrRequired) {
+		t.Fatalf("wrong error %v", err)
+	}
+}
+
+type embedA struct {
+	A    string
+	Same string
+}
+
+type EmbedB struct {
+	B    string
+	Same string `tt:"Same"`
+}
+
+type EmbedC struct {
+	Same string
+}
+
+type EmbedData struct {
+	*embedA
+	*EmbedB
+	Name  string `tt:"name"`
+	Skip  string `tt:"-"`
+	Outer string
+}
+
+func TestEmbeddedFields(t *testing.T) {
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	if err := enc.Encode(&EmbedData{EmbedB: &EmbedB{"b", "same"}, Name: "n", Skip: "s", Outer: "o"}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(buf.String(), "\n")
+	if !strings.HasSuffix(lines[0], "EmbedData#1\tA\tB\tSame\tname\tOuter") || lines[1] != "\tb\tsame\tn\to" {
+		t.Fatalf("wrong lines %q", lines)
+	}
+	//未导出类型的嵌入指针不能分配
+	v := EmbedData{}
+	if err := NewDecoder(strings.NewReader(buf.String())).Decode(&v); err == nil {
+		t.Fatal("want error of the unexported embedded pointer")
+	}
+	dec := NewDecoder(strings.NewReader(lines[0] + "\n" + "\tb\tsame\tn\to\n"))
+	v = EmbedData{embedA: &embedA{}}
+	if err := dec.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.EmbedB == nil || *v.EmbedB != (EmbedB{"b", "same"}) || v.embedA.Same != "" || v.Name != "n" || v.Outer != "o" {
+		t.Fatalf("wrong value %+v", v)
+	}
+	type Ambiguous struct {
+		EmbedB
+		EmbedC
+		embedA
+	}
+	if err := enc.Encode(&Ambiguous{}); err != nil {
+		t.Fatal(err)
+	}
+	type Conflict struct {
+		EmbedC
+		embedA
+	}
+	if err := enc.Encode(&Conflict{}); !errors.Is(err, ErrAmbiguousField) {
+		t.Fatalf("wrong error %v", err)
+	}
+}
+
+type Event interface {
+	Kind() string
+}
+
+type Created struct {
+	ID   int
+	Name string
+}
+
+func (Created) Kind() string { return "created" }
+
+type Renamed struct {
+	ID      int
+	Names   []byte
+	Payload Event
+}
+
+func (*Renamed) Kind() string { return "renamed" }
+
+type EventRecord struct {
+	Seq     int
+	Payload Event
+}
+
+func init() {
+	RegisterName("gott.Created", Created{})
+	RegisterName("gott.Renamed", &Renamed{})
+}
+
+func TestVariant(t *testing.T) {
+	events := []EventRecord{
+		{1, Created{7, "a\tb"}},
+		{2, &Renamed{7, []byte("x"), Created{8, ""}}},
+		{3, nil},
+	}
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	for i := range events {
+		if err := enc.Encode(&events[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dec := NewDecoder(bytes.NewReader(buf.Bytes()))
+	for i := range events {
+		v := EventRecord{}
+		if err := dec.Decode(&v); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(v, events[i]) {
+			t.Fatalf("wrong event %#v", v)
+		}
+	}
+	//普通的Reader可以读取
+	r := NewReader(bytes.NewReader(buf.Bytes()))
+	r.FieldsPerRecord = -1
+	lines, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	//具体值的类型和结构一样注册
+	if !reflect.DeepEqual(lines[0], []string{"*", "gott", "Created#1", "ID", "Name"}) ||
+		lines[2][1] != "gott\tCreated#1\t7\t`a\tb`" {
+		t.Fatalf("wrong lines %q", lines)
+	}
+	//增加属性之前写入的记录按照属性名称解码
+	dec = NewDecoder(strings.NewReader("`*`\tgott\tCreated#1\tID\n" +
+		"`*`\tgott\tEventRecord#1\tSeq\tPayload\n1\t`gott\tCreated#1\t7`\n"))
+	v := EventRecord{}
+	if err := dec.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, EventRecord{1, Created{7, ""}}) {
+		t.Fatalf("wrong event %#v", v)
+	}
+	dec = NewDecoder(strings.NewReader("`*`\tother\tType#1\tA\n" +
+		"`*`\tgott\tEventRecord#1\tSeq\tPayload\n1\t`other\tType#1\t1`\n"))
+	if err := dec.Decode(&EventRecord{}); !errors.Is(err, ErrNotRegistered) {
+		t.Fatalf("wrong error %v", err)
+	}
+	//具体值不经过钩子，可逆的钩子能还原
+	reverse := func(tp reflect.Type, field, value string) (string, error) {
+		r := []rune(value)
+		for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+			r[i], r[j] = r[j], r[i]
+		}
+		return string(r), nil
+	}
+	buf.Reset()
+	enc = NewEncoder(buf)
+	enc.FieldHooks = []FieldHook{reverse}
+	if err := enc.Encode(&EventRecord{12, Created{7, "hello"}}); err != nil {
+		t.Fatal(err)
+	}
+	dec = NewDecoder(buf)
+	dec.FieldHooks = []FieldHook{reverse}
+	v = EventRecord{}
+	if err := dec.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, EventRecord{12, Created{7, "hello"}}) {
+		t.Fatalf("wrong event %#v", v)
+	}
+	//没有注册的具体值不能写入
+	type R = struct{ Any interface{} }
+	if err := NewEncoder(&bytes.Buffer{}).Encode(&R{"hello"}); !errors.Is(err, ErrNotRegistered) {
+		t.Fatalf("wrong error %v", err)
+	}
+}
+
+type OrderLine struct {
+	Item string `tt:",required"`
+	Qty  int
+	Tags []*OrderTag
+}
+
+type OrderTag struct {
+	Name string
+}
+
+type Order struct {
+	ID    int
+	Lines []OrderLine
+	Total int
+	Notes []*OrderTag
+}
+
+func (o *Order) AfterDecodeTT() error {
+	o.Total = 0
+	for _, l := range o.Lines {
+		o.Total += l.Qty
+	}
+	return nil
+}
+
+func TestChildRecords(t *testing.T) {
+	orders := []Order{
+		{1, []OrderLine{{"a", 1, nil}, {"b", 2, []*OrderTag{{"x"}, {"y"}}}}, 3, []*OrderTag{{"n"}}},
+		{2, nil, 0, nil},
+		{3, []OrderLine{{"c", 5, nil}}, 5, nil},
+	}
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	for i := range orders {
+		if err := enc.Encode(&orders[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dec := NewDecoder(bytes.NewReader(buf.Bytes()))
+	for i := range orders {
+		v := Order{}
+		if err := dec.Decode(&v); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(v, orders[i]) {
+			t.Fatalf("wrong order %#v", v)
+		}
+	}
+	if err := dec.Decode(&Order{}); err != io.EOF {
+		t.Fatalf("wrong error %v", err)
+	}
+	//普通的Reader读取到的是单独的记录
+	r := NewReader(bytes.NewReader(buf.Bytes()))
+	r.FieldsPerRecord = -1
+	lines, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 14 || !reflect.DeepEqual(lines[1], []string{"1", "2", "3", "1"}) {
+		t.Fatalf("wrong lines %q", lines)
+	}
+	//子记录的校验错误和父记录一起返回，之后可以继续读取
+	buf.Reset()
+	enc = NewEncoder(buf)
+	if err := enc.Encode(&Order{4, []OrderLine{{"", 1, nil}}, 1, nil}); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Encode(&Order{5, nil, 0, nil}); err != nil {
+		t.Fatal(err)
+	}
+	dec = NewDecoder(buf)
+	var errs ValidationErrors
+	if err := dec.Decode(&Order{}); !errors.As(err, &errs) || len(errs) != 1 || errs[0].Field != "Item" || errs[0].Record != 2 {
+		t.Fatalf("wrong error %v", err)
+	}
+	v := Order{}
+	if err := dec.Decode(&v); err != nil || v.ID != 5 {
+		t.Fatalf("wrong order %v %v", v, err)
+	}
+	//作为单个值编码的结构的切片不是子记录
+	if err := enc.Encode(&struct {
+		ID    int64
+		Times []time.Time
+	}{1, []time.Time{time.Now()}}); err == nil {
+		t.Fatal("want error of []time.Time")
+	}
+	if err := enc.Encode(&struct{ Names []sql.NullString }{[]sql.NullString{{}}}); err == nil {
+		t.Fatal("want error of []sql.NullString")
+	}
+	//钩子不改变子记录的个数
+	buf.Reset()
+	enc = NewEncoder(buf)
+	enc.FieldHooks = []FieldHook{func(_ reflect.Type, _, value string) (string, error) {
+		return value + "!", nil
+	}}
+	if err := enc.Encode(&Order{6, []OrderLine{{"d", 1, nil}}, 1, nil}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "\n6!\t1\t1!\t0\n") {
+		t.Fatalf("wrong output %q", buf)
+	}
+	//子记录出错后，以后的读取都返回错误
+	src := "`*`\tgott\tOrder#1\tID\tLines\n1\t2\n" +
+		"`*`\tgott\tOrderLine#1\tItem\tQty\na\tx\nb\t2\n" +
+		"`@`\tgott\tOrder#1\n2\t0\n"
+	dec = NewDecoder(strings.NewReader(src))
+	err = dec.Decode(&v)
+	if err == nil {
+		t.Fatal("want error of the child record")
+	}
+	if err2 := dec.Decode(&v); err2 != err {
+		t.Fatalf("wrong error %v", err2)
+	}
+}
+
+// TestContextTimeout 超时后继续使用Encoder和Reader，用-race运行检查数据竞争
+func TestContextTimeout(t *testing.T) {
+	type R = struct{ One string }
+	pr, pw := io.Pipe()
+	enc := NewEncoder(pw)
+	done := make(chan []byte)
+	go func() {
+		//先读第一个记录，然后停止读取，使第二个记录的写入阻塞
+		buf := make([]byte, 64)
+		n, _ := pr.Read(buf)
+		time.Sleep(50 * time.Millisecond)
+		rest, _ := io.ReadAll(pr)
+		done <- append(buf[:n], rest...)
+	}()
+	if err := enc.Encode(&R{"a"}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := enc.EncodeContext(ctx, &R{"b"})
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.HasPrefix(err.Error(), "record 1:") {
+		t.Fatalf("wrong error %v", err)
+	}
+	//Writer等待后台的写入完成
+	if err := enc.Writer().Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Encode(&R{"c"}); err != nil {
+		t.Fatal(err)
+	}
+	pw.Close()
+	if b := <-done; string(b) != "`*`\t\t#1\tOne\na\nb\nc\n" {
+		t.Fatalf("wrong output %q", b)
+	}
+
+	pr, pw = io.Pipe()
+	r := NewReader(pr)
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := r.ReadContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wrong error %v", err)
+	}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		pw.Write([]byte("x\ty\nz\tw\n"))
+		pw.Close()
+	}()
+	//FieldPos和InputOffset等待后台的读取完成
+	if line, column := r.FieldPos(1); line != 1 || column != 3 {
+		t.Fatalf("wrong position %d:%d", line, column)
+	}
+	if off := r.InputOffset(); off != 4 {
+		t.Fatalf("wrong offset %d", off)
+	}
+	if _, err := r.Checkpoint(); err == nil {
+		t.Fatal("want error of the pending record")
+	}
+	lines, err := r.ReadAll()
+	if err != nil || !reflect.DeepEqual(lines, [][]string{{"x", "y"}, {"z", "w"}}) {
+		t.Fatalf("wrong lines %q %v", lines, err)
+	}
+
+	//在子记录中间超时，v不改变，之后从记录块的开始继续解码
+	orders := []Order{
+		{1, []OrderLine{{"a", 1, nil}, {"b", 2, []*OrderTag{{"x"}}}}, 3, nil},
+		{2, nil, 0, nil},
+	}
+	buf := &bytes.Buffer{}
+	enc = NewEncoder(buf)
+	for i := range orders {
+		if err := enc.Encode(&orders[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	src := buf.String()
+	cut := strings.Index(src, "\nb\t") + 1
+	pr, pw = io.Pipe()
+	go pw.Write([]byte(src[:cut]))
+	dec := NewDecoder(pr)
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	v := Order{ID: 99}
+	if err := dec.DecodeContext(ctx, &v); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wrong error %v", err)
+	}
+	if !reflect.DeepEqual(v, Order{ID: 99}) {
+		t.Fatalf("changed value %#v", v)
+	}
+	go func() {
+		pw.Write([]byte(src[cut:]))
+		pw.Close()
+	}()
+	for i := range orders {
+		v = Order{}
+		if err := dec.DecodeContext(context.Background(), &v); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(v, orders[i]) {
+			t.Fatalf("wrong order %#v", v)
+		}
+	}
+	if err := dec.Decode(&Order{}); err != io.EOF {
+		t.Fatalf("wrong error %v", err)
+	}
+}
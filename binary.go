@@ -0,0 +1,102 @@
+package gott
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"unicode/utf8"
+)
+
+// Binary formats of []byte and [N]byte values. They can be used for the
+// BytesFormat of an Encoder or a Decoder and as the bytes option of a field
+// tag, e.g.
+//
+//	Hash [32]byte `tt:",bytes=hex"`
+//
+// BytesRaw writes the bytes themselves, quoted by the Writer when needed (a
+// multi-line value gets the ^id^ quoting), so it requires the content to be
+// valid UTF-8 text.
+const (
+	BytesBase64    = "base64"    // base64.StdEncoding, the default
+	BytesBase64URL = "base64url" // base64.RawURLEncoding
+	BytesBase32    = "base32"    // base32.StdEncoding
+	BytesHex       = "hex"
+	BytesRaw       = "raw"
+)
+
+// bytesOf 返回[]byte或者[N]byte(包括以其定义的类型)的内容
+func bytesOf(value reflect.Value) ([]byte, bool) {
+	switch value.Kind() {
+	case reflect.Slice:
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			return value.Bytes(), true
+		}
+	case reflect.Array:
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, value.Len())
+			reflect.Copy(reflect.ValueOf(b), value)
+			return b, true
+		}
+	}
+	return nil, false
+}
+
+func encodeBytes(b []byte, c codec) (string, error) {
+	switch c.bytesFormat {
+	case "", BytesBase64:
+		return base64.StdEncoding.EncodeToString(b), nil
+	case BytesBase64URL:
+		return base64.RawURLEncoding.EncodeToString(b), nil
+	case BytesBase32:
+		return base32.StdEncoding.EncodeToString(b), nil
+	case BytesHex:
+		return hex.EncodeToString(b), nil
+	case BytesRaw:
+		if !utf8.Valid(b) {
+			return "", fmt.Errorf("the bytes are not valid text, can't use the %s format", BytesRaw)
+		}
+		return string(b), nil
+	default:
+		return "", fmt.Errorf("invalid bytes format :%s", c.bytesFormat)
+	}
+}
+
+func decodeBytes(s string, c codec) ([]byte, error) {
+	switch c.bytesFormat {
+	case "", BytesBase64:
+		return base64.StdEncoding.DecodeString(s)
+	case BytesBase64URL:
+		return base64.RawURLEncoding.DecodeString(s)
+	case BytesBase32:
+		return base32.StdEncoding.DecodeString(s)
+	case BytesHex:
+		return hex.DecodeString(s)
+	case BytesRaw:
+		return []byte(s), nil
+	default:
+		return nil, fmt.Errorf("invalid bytes format :%s", c.bytesFormat)
+	}
+}
+
+// setBytes 解码到[]byte或者[N]byte，数组的长度必须和内容一致，空字符串为零值
+func setBytes(s string, value reflect.Value, c codec) error {
+	if s == "" {
+		value.Set(reflect.Zero(value.Type()))
+		return nil
+	}
+	b, err := decodeBytes(s, c)
+	if err != nil {
+		return err
+	}
+	if value.Kind() == reflect.Array {
+		if len(b) != value.Len() {
+			return fmt.Errorf("the bytes length %d not equ %s", len(b), value.Type())
+		}
+		reflect.Copy(value, reflect.ValueOf(b))
+		return nil
+	}
+	value.SetBytes(b)
+	return nil
+}
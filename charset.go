@@ -0,0 +1,69 @@
+package gott
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// boms 是各字符集的字节顺序标记，按照长度从长到短排列，避免误判
+var boms = []struct {
+	bom []byte
+	enc encoding.Encoding
+}{
+	{[]byte{0x84, 0x31, 0x95, 0x33}, simplifiedchinese.GB18030},
+	{[]byte{0xef, 0xbb, 0xbf}, nil},
+	{[]byte{0xff, 0xfe}, unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)},
+	{[]byte{0xfe, 0xff}, unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)},
+}
+
+// peekAvailable 预读最多n个字节，没有缓存的输入时只读取一次，不等待更多的输入，
+// 以免跟随的文件在文件尾阻塞
+func peekAvailable(br *bufio.Reader, n int) []byte {
+	if br.Buffered() == 0 {
+		br.Peek(1)
+	}
+	if b := br.Buffered(); b < n {
+		n = b
+	}
+	buf, _ := br.Peek(n)
+	return buf
+}
+
+// detectEncoding 根据字节顺序标记确定字符集，UTF-8或者没有标记时返回nil。
+// 只检查第一次读取到的输入，短于标记的文件也能读取
+func detectEncoding(br *bufio.Reader) encoding.Encoding {
+	head := peekAvailable(br, 4)
+	for _, b := range boms {
+		if bytes.HasPrefix(head, b.bom) {
+			return b.enc
+		}
+	}
+	return nil
+}
+
+// decodingReader 返回把enc转换为UTF-8的Reader，enc为nil时根据字节顺序标记确定，
+// 字节顺序标记转换后为U+FEFF，由调用者去掉；需要转换时transcoded为true
+func decodingReader(r io.Reader, enc encoding.Encoding) (_ io.Reader, transcoded bool) {
+	br := bufio.NewReader(r)
+	if enc == nil {
+		enc = detectEncoding(br)
+	}
+	if enc == nil || enc == unicode.UTF8 {
+		return br, false
+	}
+	return transform.NewReader(br, enc.NewDecoder()), true
+}
+
+// encodingWriter 返回把UTF-8转换为enc的Writer，enc为nil时不转换
+func encodingWriter(w io.Writer, enc encoding.Encoding) io.Writer {
+	if enc == nil || enc == unicode.UTF8 {
+		return w
+	}
+	return transform.NewWriter(w, enc.NewEncoder())
+}
@@ -0,0 +1,116 @@
+package gott
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// checkpoint 是断点的内容，编码为json
+type checkpoint struct {
+	Offset          int64
+	Line, Column    int
+	FieldsPerRecord int
+	Records         int              `json:",omitempty"` //Decoder已经读取的数据行数
+	Types           []checkpointType `json:",omitempty"`
+	Current         *ttType          `json:",omitempty"`
+}
+
+type checkpointType struct {
+	ttType
+	Columns []string
+}
+
+// checkpoint 返回读取器当前位置的断点
+func (r *Reader) checkpoint() (*checkpoint, error) {
+	if r.pending != nil || r.ready != nil {
+		return nil, errors.New("checkpoint while a read is pending")
+	}
+	r.init()
+	if r.transcoded {
+		return nil, errors.New("checkpoint of transcoded input is not supported")
+	}
+	return &checkpoint{
+		Offset:          r.r.offset,
+		Line:            r.r.line,
+		Column:          r.r.column,
+		FieldsPerRecord: r.FieldsPerRecord,
+	}, nil
+}
+
+// Checkpoint returns an opaque token for the position after the record most
+// recently read, to be passed to ResumeReader. The input must be UTF-8.
+func (r *Reader) Checkpoint() ([]byte, error) {
+	cp, err := r.checkpoint()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(cp)
+}
+
+// Checkpoint returns an opaque token for the position after the record most
+// recently decoded, including the registered types and the current type, to
+// be passed to ResumeDecoder. The input must be UTF-8.
+func (t *Decoder) Checkpoint() ([]byte, error) {
+	if len(t.replay) > 0 {
+		return nil, errors.New("checkpoint in the middle of a block of child records")
+	}
+	cp, err := t.reader.checkpoint()
+	if err != nil {
+		return nil, err
+	}
+	for ty, cols := range t.types {
+		cp.Types = append(cp.Types, checkpointType{ty, cols})
+	}
+	cp.Current = t.currentType
+	cp.Records = t.records
+	return json.Marshal(cp)
+}
+
+// resume 解析断点，把rs定位到断点的位置，返回从断点开始读取的读取器
+func resume(rs io.ReadSeeker, token []byte) (*Reader, *checkpoint, error) {
+	cp := &checkpoint{}
+	if err := json.Unmarshal(token, cp); err != nil {
+		return nil, nil, fmt.Errorf("invalid checkpoint: %v", err)
+	}
+	if _, err := rs.Seek(cp.Offset, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+	r := NewReader(rs)
+	//不再检查字节顺序标记，行列位置从断点继续
+	r.r = &posReader{r: bufio.NewReader(rs), offset: cp.Offset, line: cp.Line, column: cp.Column}
+	r.FieldsPerRecord = cp.FieldsPerRecord
+	return r, cp, nil
+}
+
+// ResumeReader returns a Reader that reads rs from the position of a token
+// returned by Reader.Checkpoint. The settings of the Reader, other than
+// FieldsPerRecord, must be set again as they were; Encoding is not used.
+func ResumeReader(rs io.ReadSeeker, token []byte) (*Reader, error) {
+	r, _, err := resume(rs, token)
+	return r, err
+}
+
+// ResumeDecoder returns a Decoder that decodes rs from the position of a
+// token returned by Decoder.Checkpoint, with the types registered before it.
+// The records keep their numbers in the file, see ValidationError. The
+// settings of the Decoder and its Reader must be set again as they were.
+func ResumeDecoder(rs io.ReadSeeker, token []byte) (*Decoder, error) {
+	r, cp, err := resume(rs, token)
+	if err != nil {
+		return nil, err
+	}
+	dec := &Decoder{reader: r, types: map[ttType][]string{}, records: cp.Records}
+	for _, ty := range cp.Types {
+		dec.types[ty.ttType] = ty.Columns
+	}
+	if cp.Current != nil {
+		if _, ok := dec.types[*cp.Current]; !ok {
+			return nil, fmt.Errorf("invalid checkpoint: the type %s not found", cp.Current)
+		}
+		dec.currentType = cp.Current
+	}
+	return dec, nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/linlexing/gott"
+)
+
+func testOptions() *options {
+	return &options{comma: '\t', comment: '#', typ: "json.Record"}
+}
+
+func TestJSON(t *testing.T) {
+	src := "{\"a\":1,\"b\":\"x\\ty\",\"c\":null}\n{\"a\":2,\"b\":\"z\",\"c\":[1, 2]}\n{\"a\":3}\n"
+	tt := &bytes.Buffer{}
+	if err := fromJSON(testOptions(), strings.NewReader(src), tt); err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	if err := toJSON(testOptions(), tt, out); err != nil {
+		t.Fatal(err)
+	}
+	want := "{\"a\":\"1\",\"b\":\"x\\ty\",\"c\":\"\"}\n{\"a\":\"2\",\"b\":\"z\",\"c\":\"[1,2]\"}\n{\"a\":\"3\"}\n"
+	if out.String() != want {
+		t.Fatalf("not equ,\n%s\n%s", want, out)
+	}
+	out.Reset()
+	if err := toJSON(testOptions(), strings.NewReader("#header\nname\tage\nfoo\t12\n"), out); err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\"name\":\"foo\",\"age\":\"12\"}\n"; out.String() != want {
+		t.Fatalf("not equ,\n%s\n%s", want, out)
+	}
+	//注释符号开始的值需要引用，按照引用策略写入
+	o := testOptions()
+	o.quote = gott.QuoteBacktick
+	tt.Reset()
+	if err := fromJSON(o, strings.NewReader("{\"a\":\"#x\"}\n"), tt); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(tt.String(), "\n"); lines[1] != "`#x`" {
+		t.Fatalf("wrong lines %q", lines)
+	}
+	out.Reset()
+	if err := toJSON(o, tt, out); err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\"a\":\"#x\"}\n"; out.String() != want {
+		t.Fatalf("not equ,\n%s\n%s", want, out)
+	}
+	if err := fromJSON(testOptions(), strings.NewReader("{\"a\":1}\n{}\n"), &bytes.Buffer{}); err == nil {
+		t.Fatal("want error of empty object")
+	}
+	//带字节顺序标记的类型化文件
+	out.Reset()
+	if err := toJSON(testOptions(), strings.NewReader("\ufeff#c\n`*`\tgott\tT#1\tOne\n1\n"), out); err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\"One\":\"1\"}\n"; out.String() != want {
+		t.Fatalf("not equ,\n%s\n%s", want, out)
+	}
+}
+
+func TestCSV(t *testing.T) {
+	src := "c1,c2\n1,\"multi\nline\"\n2,a\tb\n3,\"x,y\"\n"
+	tt := &bytes.Buffer{}
+	if err := fromCSV(testOptions(), strings.NewReader(src), tt); err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	if err := toCSV(testOptions(), tt, out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != src {
+		t.Fatalf("not equ,\n%s\n%s", src, out)
+	}
+}
+
+func TestFmt(t *testing.T) {
+	src := "#comment\n`*`\tgott\tT#1\tOne\tTwo\n\n`foo`\t^1^bar^1^\n`a\tb`\t^^x`y^^\n"
+	want := "#comment\n`*`\tgott\tT#1\tOne\tTwo\nfoo\tbar\n`a\tb`\t^^x`y^^\n"
+	out := &bytes.Buffer{}
+	if err := format(testOptions(), strings.NewReader(src), out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != want {
+		t.Fatalf("not equ,\n%q\n%q", want, out)
+	}
+	o := testOptions()
+	o.quote = gott.QuoteHeredoc
+	out.Reset()
+	if err := format(o, strings.NewReader("a\t`b\nc`\n"), out); err != nil {
+		t.Fatal(err)
+	}
+	if want := "a\t^^b\nc^^\n"; out.String() != want {
+		t.Fatalf("not equ,\n%q\n%q", want, out)
+	}
+}
+
+func TestLint(t *testing.T) {
+	src := "`*`\tgott\tT#1\tOne\tTwo\n1\t2\n1\n`@`\tgott\tX\n`foo`bar\t2\n1\t2\n"
+	want := "a.tt:3:1: wrong number of fields in line, has 1 fields, type gott.T#1 has 2 props\n" +
+		"a.tt:4:1: the type gott.X not found\n" +
+		"a.tt:5:6: extraneous ` in field\n"
+	out := &bytes.Buffer{}
+	n, err := lint(testOptions(), "a.tt", strings.NewReader(src), out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 || out.String() != want {
+		t.Fatalf("not equ,\n%s\n%s", want, out)
+	}
+	out.Reset()
+	if n, err = lint(testOptions(), "a.tt", strings.NewReader("\ufeff"+src), out); err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 || out.String() != want {
+		t.Fatalf("not equ,\n%s\n%s", want, out)
+	}
+	out.Reset()
+	if n, err = lint(testOptions(), "b.tt", strings.NewReader("a\tb\nc\n^1^d\n"), out); err != nil {
+		t.Fatal(err)
+	}
+	want = "b.tt:2:1: wrong number of fields in line, has 1 fields, must be 2\n" +
+		"b.tt:3:1: quoted-field not end\n"
+	if n != 2 || out.String() != want {
+		t.Fatalf("not equ,\n%s\n%s", want, out)
+	}
+}
+
+func TestPretty(t *testing.T) {
+	src := "#comment\n`*`\tgott\tT#1\tOne\tTwo\n张三\t1\nBob\t`x `\n"
+	want := "#comment\n`*`\tgott\tT#1\tOne\tTwo\n张三\t1\nBob \t`x `\n"
+	o := testOptions()
+	o.trim, o.pretty = true, true
+	out := &bytes.Buffer{}
+	if err := format(o, strings.NewReader(src), out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != want {
+		t.Fatalf("not equ,\n%q\n%q", want, out)
+	}
+	//再次对齐结果不变
+	again := &bytes.Buffer{}
+	if err := format(o, bytes.NewReader(out.Bytes()), again); err != nil {
+		t.Fatal(err)
+	}
+	if again.String() != want {
+		t.Fatalf("not equ,\n%q\n%q", want, again)
+	}
+}
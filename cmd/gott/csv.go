@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+)
+
+// toCSV 逐条转换记录，类型行也作为普通记录输出
+func toCSV(o *options, in io.Reader, out io.Writer) error {
+	r := o.newReader(in)
+	r.FieldsPerRecord = -1
+	w := csv.NewWriter(out)
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func fromCSV(o *options, in io.Reader, out io.Writer) error {
+	r := csv.NewReader(in)
+	r.FieldsPerRecord = -1
+	w := o.newWriter(out)
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
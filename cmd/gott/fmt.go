@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// format 把in中的记录用规范的引用方式写入out，保留注释，去掉空行
+func format(o *options, in io.Reader, out io.Writer) error {
+	r := o.newReader(in)
+	r.FieldsPerRecord = -1
+	w := o.newWriter(out)
+	for {
+		values, formats, err := r.ReadWithFormat()
+		if values == nil && formats != nil {
+			//注释
+			if err := w.WriteComment(strings.TrimRight(formats[0], "\r\n")); err != nil {
+				return err
+			}
+		} else if values != nil {
+			if (values[0] == "*" || values[0] == "@") && formats[0] != "" {
+				//类型行的标识符号必须引用
+				fmts := make([]string, len(values))
+				for i, v := range values {
+					fmts[i] = w.FieldFormat(v)
+				}
+				fmts[0] = "`"
+				if err := w.WriteWithFormat(values, fmts); err != nil {
+					return err
+				}
+			} else if err := w.Write(values); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+func runFmt(o *options, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		if o.write {
+			return errUsage
+		}
+		return format(o, os.Stdin, out)
+	}
+	for _, name := range args {
+		src, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		buf := &bytes.Buffer{}
+		if err := format(o, bytes.NewReader(src), buf); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		if !o.write {
+			if _, err := out.Write(buf.Bytes()); err != nil {
+				return err
+			}
+			continue
+		}
+		if bytes.Equal(src, buf.Bytes()) {
+			continue
+		}
+		fi, err := os.Stat(name)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(name, buf.Bytes(), fi.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runPretty 和fmt相同，但是对齐输出的列，输入可以是已经对齐的文件
+func runPretty(o *options, args []string, out io.Writer) error {
+	o.trim, o.pretty = true, true
+	return runFmt(o, args, out)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/linlexing/gott"
+)
+
+// typedPeekSize 是判断文件是否为类型化文件时最多预读的字节数
+const typedPeekSize = 64 * 1024
+
+// isTyped 预读输入，用Reader读取第一个记录，处理字节顺序标记和字符集，
+// 跳过空行和注释行后，第一个字段是引用的*的是类型化文件
+func isTyped(o *options, br *bufio.Reader) bool {
+	buf, _ := br.Peek(typedPeekSize)
+	r := o.newReader(bytes.NewReader(buf))
+	r.FieldsPerRecord = -1
+	for {
+		values, formats, err := r.ReadWithFormat()
+		if len(values) > 0 {
+			return values[0] == "*" && formats[0] != ""
+		}
+		if err != nil {
+			return false
+		}
+	}
+}
+
+// writeObject 按照列的顺序输出一个json对象
+func writeObject(w *bufio.Writer, columns, values []string) error {
+	w.WriteByte('{')
+	for i, col := range columns {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		key, err := json.Marshal(col)
+		if err != nil {
+			return err
+		}
+		value, err := json.Marshal(values[i])
+		if err != nil {
+			return err
+		}
+		w.Write(key)
+		w.WriteByte(':')
+		w.Write(value)
+	}
+	w.WriteByte('}')
+	return w.WriteByte('\n')
+}
+
+func toJSON(o *options, in io.Reader, out io.Writer) error {
+	br := bufio.NewReaderSize(in, typedPeekSize)
+	w := bufio.NewWriter(out)
+	if isTyped(o, br) {
+		dec := gott.NewDecoder(br)
+		o.setReader(dec.Reader())
+		for {
+			row, err := dec.DecodeRow()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if err := writeObject(w, row.Columns, row.Values); err != nil {
+				return err
+			}
+		}
+	} else {
+		r := o.newReader(br)
+		header, err := r.Read()
+		if err != nil && err != io.EOF {
+			return err
+		}
+		for err == nil {
+			var record []string
+			record, err = r.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if err = writeObject(w, header, record); err != nil {
+				return err
+			}
+		}
+	}
+	return w.Flush()
+}
+
+// jsonText 把json值转换为字段的文本，字符串取其内容，null为空字符串，
+// 其他的值保留其紧凑的json文本
+func jsonText(raw json.RawMessage) (string, error) {
+	switch raw[0] {
+	case '"':
+		var s string
+		err := json.Unmarshal(raw, &s)
+		return s, err
+	case 'n':
+		return "", nil
+	default:
+		buf := &bytes.Buffer{}
+		err := json.Compact(buf, raw)
+		return buf.String(), err
+	}
+}
+
+// readObject 读取一个json对象，保持键的原有顺序
+func readObject(d *json.Decoder) (keys, values []string, err error) {
+	tok, err := d.Token()
+	if err != nil {
+		return nil, nil, err
+	}
+	if tok != json.Delim('{') {
+		return nil, nil, fmt.Errorf("offset %d: expected a json object, got %v", d.InputOffset(), tok)
+	}
+	for d.More() {
+		if tok, err = d.Token(); err != nil {
+			return nil, nil, err
+		}
+		var raw json.RawMessage
+		if err = d.Decode(&raw); err != nil {
+			return nil, nil, err
+		}
+		value, err := jsonText(raw)
+		if err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, tok.(string))
+		values = append(values, value)
+	}
+	_, err = d.Token()
+	return keys, values, err
+}
+
+func fromJSON(o *options, in io.Reader, out io.Writer) error {
+	row := &gott.Row{Name: o.typ}
+	if i := strings.LastIndex(o.typ, "."); i >= 0 {
+		row.PkgPath, row.Name = o.typ[:i], o.typ[i+1:]
+	}
+	enc := gott.NewEncoder(out)
+	o.setWriter(enc.Writer())
+	d := json.NewDecoder(in)
+	for {
+		keys, values, err := readObject(d)
+		if err == io.EOF {
+			//美化输出时记录缓存在写入器中
+			return enc.Writer().Flush()
+		}
+		if err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			//没有属性的类型行不能和数据行区分
+			return fmt.Errorf("offset %d: empty json object", d.InputOffset())
+		}
+		row.Columns, row.Values = keys, values
+		if err := enc.EncodeRow(row); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/linlexing/gott"
+)
+
+// lint 检查in的内容，把发现的问题按照 文件:行:列: 信息 的格式写入out，
+// 返回问题的个数。语法错误之后从下一行继续检查
+func lint(o *options, name string, in io.Reader, out io.Writer) (int, error) {
+	br := bufio.NewReaderSize(in, typedPeekSize)
+	var next func() error
+	if isTyped(o, br) {
+		dec := gott.NewDecoder(br)
+		o.setReader(dec.Reader())
+		next = func() error {
+			_, err := dec.DecodeRow()
+			return err
+		}
+	} else {
+		r := o.newReader(br)
+		next = func() error {
+			_, err := r.Read()
+			return err
+		}
+	}
+	n := 0
+	for {
+		err := next()
+		if err == io.EOF {
+			return n, nil
+		}
+		var pe *gott.ParseError
+		if !errors.As(err, &pe) {
+			if err != nil {
+				return n, err
+			}
+			continue
+		}
+		n++
+		if _, err := fmt.Fprintf(out, "%s:%d:%d: %v\n", name, pe.Line, pe.Column, pe.Err); err != nil {
+			return n, err
+		}
+	}
+}
+
+func runLint(o *options, args []string, out io.Writer) error {
+	n := 0
+	if len(args) == 0 {
+		m, err := lint(o, "<stdin>", os.Stdin, out)
+		if err != nil {
+			return err
+		}
+		n += m
+	}
+	for _, name := range args {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		m, err := lint(o, name, f, out)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		n += m
+	}
+	if n > 0 {
+		return errProblems
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+// Command gott converts TT files to and from other formats.
+//
+// Usage:
+//
+//	gott <command> [flags] [file...]
+//
+// The commands are:
+//
+//	to-csv     convert TT records to CSV
+//	from-csv   convert CSV records to TT
+//	to-json    convert TT records to NDJSON, one object per record
+//	from-json  convert NDJSON objects to a typed TT file
+//	fmt        rewrite TT files with canonical quoting
+//	pretty     rewrite TT files with aligned columns
+//	lint       check TT files for errors
+//
+// The conversions read one file, or the standard input when file is omitted,
+// and write to the standard output.
+//
+// to-json uses the column names of the `*` type lines as object keys when the
+// file is typed, otherwise the first record is taken as the header.
+// from-json registers one type (see -type) whose columns are the keys of each
+// object, in the order they appear; objects with a different key set register
+// a new version of the type.
+//
+// fmt rewrites every field with the quoting Writer.Write would choose, keeps
+// comment lines and drops blank lines. -quote selects the quoting policy:
+// minimal (the default), backtick, heredoc or readable. With -w the files
+// are rewritten in place, otherwise the result is written to the standard
+// output.
+//
+// pretty works like fmt, but pads the fields so that the columns of
+// consecutive records with the same number of fields line up, counting East
+// Asian wide characters as two columns. Its input may already be aligned.
+// The other commands read aligned files with -trim, which drops the padding;
+// "gott fmt -trim" removes the alignment.
+//
+// lint reports syntax errors, records whose field count does not match the
+// `*` type line in effect (or, for untyped files, the first record) and `@`
+// references to types that were never registered, one per line as
+//
+//	file:line:column: message
+//
+// lint exits with status 1 when it reports any problem, so it can be used
+// in CI.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/linlexing/gott"
+)
+
+type options struct {
+	comma   rune
+	comment rune
+	typ     string
+	write   bool
+	quote   gott.QuotePolicy
+	trim    bool
+	pretty  bool
+}
+
+type command struct {
+	name  string
+	short string
+	run   func(o *options, args []string, out io.Writer) error
+}
+
+var commands = []*command{
+	{"to-csv", "convert TT records to CSV", convert(toCSV)},
+	{"from-csv", "convert CSV records to TT", convert(fromCSV)},
+	{"to-json", "convert TT records to NDJSON, one object per record", convert(toJSON)},
+	{"from-json", "convert NDJSON objects to a typed TT file", convert(fromJSON)},
+	{"fmt", "rewrite TT files with canonical quoting", runFmt},
+	{"pretty", "rewrite TT files with aligned columns", runPretty},
+	{"lint", "check TT files for errors", runLint},
+}
+
+var (
+	// errUsage 表示命令行参数错误，退出码为2
+	errUsage = errors.New("usage")
+	// errProblems 表示已经报告了问题，不再输出错误信息，退出码为1
+	errProblems = errors.New("problems found")
+)
+
+// convert 把单个输入的转换函数包装为命令，没有指定文件时读取标准输入
+func convert(f func(o *options, in io.Reader, out io.Writer) error) func(o *options, args []string, out io.Writer) error {
+	return func(o *options, args []string, out io.Writer) error {
+		if len(args) > 1 {
+			return errUsage
+		}
+		if len(args) == 0 {
+			return f(o, os.Stdin, out)
+		}
+		in, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		return f(o, in, out)
+	}
+}
+
+// runeFlag 是单个字符的命令行参数，支持\t等转义写法，空字符串表示0
+type runeFlag struct {
+	r *rune
+}
+
+func (f runeFlag) String() string {
+	if f.r == nil || *f.r == 0 {
+		return ""
+	}
+	return strconv.QuoteRune(*f.r)
+}
+
+func (f runeFlag) Set(s string) error {
+	if s == "" {
+		*f.r = 0
+		return nil
+	}
+	r, _, tail, err := strconv.UnquoteChar(s, '\'')
+	if err != nil || tail != "" {
+		return fmt.Errorf("must be a single character: %q", s)
+	}
+	*f.r = r
+	return nil
+}
+
+// quotePolicies 是-quote参数可用的引用策略
+var quotePolicies = map[string]gott.QuotePolicy{
+	"minimal":  gott.QuoteMinimal,
+	"backtick": gott.QuoteBacktick,
+	"heredoc":  gott.QuoteHeredoc,
+	"readable": gott.QuoteReadable,
+}
+
+// quoteFlag 是按名称设置的引用策略
+type quoteFlag struct {
+	p *gott.QuotePolicy
+}
+
+func (f quoteFlag) String() string {
+	for name, p := range quotePolicies {
+		if f.p != nil && *f.p == p {
+			return name
+		}
+	}
+	return ""
+}
+
+func (f quoteFlag) Set(s string) error {
+	p, ok := quotePolicies[s]
+	if !ok {
+		return fmt.Errorf("must be minimal, backtick, heredoc or readable: %q", s)
+	}
+	*f.p = p
+	return nil
+}
+
+// setReader 按照命令行参数设置读取器
+func (o *options) setReader(r *gott.Reader) {
+	r.Comma = o.comma
+	r.Comment = o.comment
+	r.TrimPadding = o.trim
+}
+
+func (o *options) newReader(in io.Reader) *gott.Reader {
+	r := gott.NewReader(in)
+	o.setReader(r)
+	return r
+}
+
+// setWriter 按照命令行参数设置写入器
+func (o *options) setWriter(w *gott.Writer) {
+	w.Comma = o.comma
+	w.Comment = o.comment
+	w.Quote = o.quote
+	w.Pretty = o.pretty
+}
+
+func (o *options) newWriter(out io.Writer) *gott.Writer {
+	w := gott.NewWriter(out)
+	o.setWriter(w)
+	return w
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: gott <command> [flags] [file...]\n\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.short)
+	}
+	fmt.Fprintf(os.Stderr, "\nrun \"gott <command> -h\" for the flags of a command\n")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	var cmd *command
+	for _, c := range commands {
+		if c.name == os.Args[1] {
+			cmd = c
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "gott: unknown command %q\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+	o := &options{comma: '\t', typ: "json.Record"}
+	fs := flag.NewFlagSet("gott "+cmd.name, flag.ExitOnError)
+	fs.Var(runeFlag{&o.comma}, "comma", "field delimiter of the TT file")
+	fs.Var(runeFlag{&o.comment}, "comment", "comment character of the TT file, empty for none")
+	if cmd.name != "pretty" {
+		fs.BoolVar(&o.trim, "trim", false, "drop the padding of TT files aligned by gott pretty")
+	}
+	switch cmd.name {
+	case "from-json":
+		fs.StringVar(&o.typ, "type", o.typ, "registered type name, as pkgpath.Name")
+	case "fmt", "pretty":
+		fs.BoolVar(&o.write, "w", false, "write the result to the source file instead of the standard output")
+		fs.Var(quoteFlag{&o.quote}, "quote", "quoting policy: minimal, backtick, heredoc or readable")
+	}
+	fs.Parse(os.Args[2:])
+	out := bufio.NewWriter(os.Stdout)
+	err := cmd.run(o, fs.Args(), out)
+	if ferr := out.Flush(); err == nil {
+		err = ferr
+	}
+	switch err {
+	case nil:
+	case errUsage:
+		fs.Usage()
+		os.Exit(2)
+	case errProblems:
+		os.Exit(1)
+	default:
+		fmt.Fprintf(os.Stderr, "gott %s: %v\n", cmd.name, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,149 @@
+package gott
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// readResult 是在后台读取的一行的结果
+type readResult struct {
+	values, formats []string
+	err             error
+}
+
+// readWithFormatContext 在后台读取一行，ctx结束时不等待读取完成，
+// 读取的结果由下一次调用返回
+func (dec *Reader) readWithFormatContext(ctx context.Context) ([]string, []string, error) {
+	if res := dec.ready; res != nil {
+		dec.ready = nil
+		return res.values, res.formats, res.err
+	}
+	//第一次读取时检测字符集也可能阻塞，在后台初始化
+	if dec.pending == nil {
+		dec.pendingPos = position{1, 1}
+		if dec.r != nil {
+			dec.pendingPos = dec.r.pos()
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, dec.contextError(err)
+	}
+	if dec.pending == nil {
+		ch := make(chan readResult, 1)
+		dec.pending = ch
+		go func() {
+			values, formats, err := dec.readWithFormat()
+			ch <- readResult{values, formats, err}
+		}()
+	}
+	select {
+	case res := <-dec.pending:
+		dec.pending = nil
+		return res.values, res.formats, res.err
+	case <-ctx.Done():
+		return nil, nil, dec.contextError(ctx.Err())
+	}
+}
+
+// settle 等待放弃的读取完成，保存其结果由下一次读取返回，
+// 之后可以安全地访问读取的状态
+func (dec *Reader) settle() {
+	if dec.pending != nil {
+		res := <-dec.pending
+		dec.pending = nil
+		dec.ready = &res
+	}
+}
+
+// contextError 返回带有读取位置的ctx错误
+func (dec *Reader) contextError(err error) error {
+	return &ParseError{Line: dec.pendingPos.line, Column: dec.pendingPos.column, Err: err}
+}
+
+// ReadContext is like Read, but returns when ctx is done even if the
+// underlying reader blocks. The error is then a *ParseError wrapping
+// ctx.Err() at the position where the unfinished record starts. The record
+// being read when ctx was done is not lost: it is returned by the next call
+// to a read method of r. Until then the read goes on in the background; the
+// methods of r wait for it, except Checkpoint that returns an error.
+func (r *Reader) ReadContext(ctx context.Context) (record []string, err error) {
+	return r.readRecord(func() ([]string, []string, error) {
+		return r.readWithFormatContext(ctx)
+	})
+}
+
+// ReadAllContext is like ReadAll, but stops when ctx is done, see
+// ReadContext.
+func (r *Reader) ReadAllContext(ctx context.Context) (records [][]string, err error) {
+	for {
+		record, err := r.ReadContext(ctx)
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+}
+
+// DecodeContext is like Decode, but returns when ctx is done even if the
+// underlying reader blocks, see Reader.ReadContext. v is not changed after
+// DecodeContext returns. The record and its child records are all read before
+// any is decoded; if ctx is done in the middle, the records already read are
+// kept, and the next call decodes them along with the rest of the block.
+func (t *Decoder) DecodeContext(ctx context.Context, v interface{}) error {
+	return t.decodeWith(v, func() ([]string, []string, error) {
+		return t.reader.readWithFormatContext(ctx)
+	})
+}
+
+// EncodeContext is like Encode, but returns when ctx is done even if the
+// underlying writer blocks. The error then wraps ctx.Err() and tells the
+// number of records encoded before. v is not used after EncodeContext
+// returns; the writing goes on in the background, and its error, if any, is
+// returned by the next call to Encode, EncodeRow or EncodeContext. Writer
+// waits for the background writing too, so the Writer is not shared with it.
+func (enc *Encoder) EncodeContext(ctx context.Context, v interface{}) error {
+	if err := enc.wait(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("record %d: %w", enc.records, err)
+	}
+	rec, err := enc.structLine(v)
+	if err != nil {
+		return err
+	}
+	//后台写入会修改records，先保存超时报告的记录数
+	records := enc.records
+	ch := make(chan error, 1)
+	enc.pending = ch
+	go func() {
+		ch <- enc.writeStruct(rec, nil, true)
+	}()
+	select {
+	case err := <-ch:
+		enc.pending = nil
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("record %d: %w", records, ctx.Err())
+	}
+}
+
+// settle 等待被放弃的EncodeContext写入完成，保存其错误
+func (enc *Encoder) settle() {
+	if enc.pending != nil {
+		enc.pendingErr = <-enc.pending
+		enc.pending = nil
+	}
+}
+
+// wait 等待被放弃的EncodeContext写入完成，返回其错误
+func (enc *Encoder) wait() error {
+	enc.settle()
+	err := enc.pendingErr
+	enc.pendingErr = nil
+	return err
+}
@@ -1,35 +1,125 @@
 package gott
 
 import (
-	"encoding/base64"
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"io"
+	"math/big"
 	"reflect"
 	"strconv"
+	"strings"
 	"time"
 )
 
 type ttType struct {
 	PkgPath string
 	Name    string
+	Version int
 }
 
-// 解析类型化的TT文件，只能序列化结构类型，支持嵌入的结构(非指针嵌入)文,
+// typeVersionSep 分隔类型名称和版本号，如 TFoo#2
+const typeVersionSep = "#"
+
+// typeName 返回写入类型行的名称，版本为0(旧格式)时不带版本号
+func (t ttType) typeName() string {
+	if t.Version == 0 {
+		return t.Name
+	}
+	return t.Name + typeVersionSep + strconv.Itoa(t.Version)
+}
+
+func (t ttType) String() string {
+	return t.PkgPath + "." + t.typeName()
+}
+
+// parseType 解析类型行中的包路径和名称，名称可以带有版本号
+func parseType(pkgPath, name string) (ttType, error) {
+	t := ttType{PkgPath: pkgPath, Name: name}
+	if i := strings.LastIndex(name, typeVersionSep); i >= 0 {
+		v, err := strconv.Atoi(name[i+len(typeVersionSep):])
+		if err != nil || v <= 0 {
+			return t, fmt.Errorf("%w: invalid type version %q", ErrTypeLine, name)
+		}
+		t.Name, t.Version = name[:i], v
+	}
+	return t, nil
+}
+
+// 解析类型化的TT文件，只能序列化结构类型，支持嵌入的结构和结构指针(读取时分配),
+// 属性的名称和同名属性的规则与encoding/json相同,
 // 写入时，先注册类型（如果没有注册过），然后写入属性，注册类型用特殊的符号*,
 // 如果已经注册过，则是引用类型，用@符号，注册或引用后，后续的数据行就是该类型的数据。
+// 类型名称后面用#带上版本号，同一类型的属性发生变化时(如程序升级后追加写入)，
+// 会用新的版本号重新注册，追加写入时用NewAppendEncoder接着文件中已有的版本。
 // 具体的文件格式如下：
-//	`*`	gott	TFoo	One	Two		--注册类型gott.TFoo，其有两个属性One Two，后面的数据行全部采用TFoo的格式
+//	`*`	gott	TFoo#1	One	Two		--注册类型gott.TFoo的版本1，其有两个属性One Two，后面的数据行全部采用TFoo的格式
 //	fooV11	fooV12					--foo的实例
 //	fooV21	fooV22					--foo的实例
-//	`*`	other	TBaro	One	Two	Three	--注册类型other.TBar，其有三个属性One Two Three，后面的数据行全部采用TBar的格式
+//	`*`	other	TBar#1	One	Two	Three	--注册类型other.TBar，其有三个属性One Two Three，后面的数据行全部采用TBar的格式
 //	barV11	barV12	barV13				--bar的实例
 //	barV11	barV12	barV13				--bar的实例
-//	`@`	gott	TFoo				--引用类型TBar，必须在前面注册过，后面的数据行全部采用TFoo的格式
+//	`@`	gott	TFoo#1				--引用类型TFoo的版本1，必须在前面注册过，后面的数据行全部采用TFoo的格式
 //	fooV31	fooV32					--foo的实例
+//	`*`	gott	TFoo#2	One	Two	Three	--注册类型gott.TFoo的版本2
+//	fooV41	fooV42	fooV43				--foo的实例
+//
+// 不带版本号的类型名称是旧的格式，重复注册时后注册的覆盖先注册的；
+// 不带版本号的引用总是指向该类型最高的版本。
+//
+// A prop of a type line may carry options after a comma, like a field tag,
+// e.g. "data,bytes=hex" as written by ExportRows; they override the options
+// of the tag of the field.
+//
+// TimeFormat and Location are the settings for time.Time values, as for the
+// Encoder. Values in a layout without a zone and Unix times are returned in
+// Location, or in UTC if it is nil; other times are converted to Location
+// when it is set.
+//
+// BytesFormat is the format of []byte and [N]byte values, as for the Encoder.
+//
+// Floats are read back whatever FloatFormat they were written with. A decoded
+// *big.Float keeps the precision of the existing value, or gets one large
+// enough for all the decimal digits.
+//
+// MaxTypes, if positive, is the maximum number of type versions a file may
+// register; a further `*` line returns a *ParseError wrapping
+// ErrTooManyTypes. Use Reader to set the limits of the records.
+//
+// Absent, if not empty, turns Decode into a patch: an unquoted field equal to
+// it leaves the struct field untouched, as does a property missing from the
+// type line, so a record can be decoded into an existing value to update it.
+// A quoted field is always the value itself. See Encoder.EncodePatch for the
+// markers allowed.
+//
+// Decode checks the constraints in the tags of the fields and calls Validate
+// if the value implements Validator, see ValidationErrors. Before that,
+// FieldHooks transform the text of the fields and AfterDecodeTT is called if
+// the value implements AfterDecoder, see FieldHook.
 type Decoder struct {
+	TimeFormat  string
+	Location    *time.Location
+	BytesFormat string
+	MaxTypes    int
+	Absent      string
+	FieldHooks  []FieldHook
 	reader      *Reader
-	types       map[*ttType][]string
+	types       map[ttType][]string
 	currentType *ttType
+	records     int        //已经读取的数据行数
+	err         error      //读取子记录出错后无法对齐记录，以后都返回该错误
+	line        int        //最近读取的数据行开始的行号
+	recording   bool       //把读取的行记录在block中
+	block       []readLine //正在读取的记录块已经读取的行
+	replay      []readLine //已经读取还没有解码的行，由以后的读取先返回
+}
+
+// readLine 是记录块中读取的一行
+type readLine struct {
+	values, formats []string
+	err             error
+	line            int
 }
 
 var (
@@ -38,30 +128,29 @@ var (
 )
 
 func NewDecoder(r io.Reader) *Decoder {
-	return &Decoder{NewReader(r), map[*ttType][]string{}, nil}
+	return &Decoder{reader: NewReader(r), types: map[ttType][]string{}}
 
 }
 
-func findPropByName(obj reflect.Type, name string) ([]int, error) {
-	for i := 0; i < obj.NumField(); i++ {
-		f := obj.Field(i)
-		if f.Anonymous && f.Type.Kind() == reflect.Struct {
-			result, err := findPropByName(f.Type, name)
-			if err != nil {
-				return nil, err
-			}
-			if result != nil {
-				return append([]int{i}, result...), err
-			}
-		} else {
-			if f.Name == name {
-				return []int{i}, nil
-			}
-		}
+func (t *Decoder) codec() codec {
+	return codec{timeFormat: t.TimeFormat, location: t.Location, bytesFormat: t.BytesFormat, types: t.types}
+}
+
+// checkAbsent 检查缺失标记不引用写入后能原样读回：按照w的方言、分隔符、结束符和注释符号
+// 最小引用时不需要引用，并且不是类型行的标记，以免引用后和类型行混淆
+func checkAbsent(marker string, w *Writer) error {
+	plain := &Writer{Comma: w.Comma, Comment: w.Comment, Dialect: w.Dialect,
+		Delimiter: w.Delimiter, Terminator: w.Terminator}
+	if plain.FieldFormat(marker) != "" || marker == "*" || marker == "@" {
+		return fmt.Errorf("invalid Absent marker %q", marker)
 	}
-	return nil, nil
+	return nil
 }
-func decode(encValue string, value reflect.Value) error {
+
+func decode(encValue string, value reflect.Value, c codec) error {
+	if value.Kind() == reflect.Interface {
+		return decodeVariant(encValue, value, c)
+	}
 	switch value.Interface().(type) {
 	case string:
 		value.Set(reflect.ValueOf(encValue))
@@ -73,7 +162,7 @@ func decode(encValue string, value reflect.Value) error {
 			if f, err := strconv.ParseFloat(encValue, 32); err != nil {
 				return err
 			} else {
-				value.Set(reflect.ValueOf(f))
+				value.SetFloat(f)
 			}
 		}
 	case float64:
@@ -112,28 +201,321 @@ func decode(encValue string, value reflect.Value) error {
 		if encValue == "" {
 			value.Set(reflect.ValueOf(time.Time{}))
 		} else {
-			if f, err := time.Parse(time.RFC3339, encValue); err != nil {
+			if f, err := parseTime(encValue, c); err != nil {
 				return err
 			} else {
 				value.Set(reflect.ValueOf(f))
 			}
 		}
-	case []byte:
+	case time.Duration:
 		if encValue == "" {
-			value.Set(reflect.ValueOf(nil))
+			value.SetInt(0)
 		} else {
-			bys, err := base64.StdEncoding.DecodeString(encValue)
+			d, err := time.ParseDuration(encValue)
 			if err != nil {
 				return err
 			}
-			value.Set(reflect.ValueOf(bys))
+			value.SetInt(int64(d))
+		}
+	case bool:
+		if encValue == "" {
+			value.SetBool(false)
+		} else {
+			b, err := strconv.ParseBool(encValue)
+			if err != nil {
+				return err
+			}
+			value.SetBool(b)
+		}
+	case []byte:
+		return setBytes(encValue, value, c)
+	case *big.Int:
+		if encValue == "" {
+			value.Set(reflect.Zero(value.Type()))
+		} else if i, ok := new(big.Int).SetString(encValue, 10); !ok {
+			return fmt.Errorf("invalid big.Int :%s", encValue)
+		} else {
+			value.Set(reflect.ValueOf(i))
+		}
+	case *big.Float:
+		if encValue == "" {
+			value.Set(reflect.Zero(value.Type()))
+		} else if f, err := parseBigFloat(encValue, value.Interface().(*big.Float)); err != nil {
+			return err
+		} else {
+			value.Set(reflect.ValueOf(f))
+		}
+	case *big.Rat:
+		if encValue == "" {
+			value.Set(reflect.Zero(value.Type()))
+		} else if r, ok := new(big.Rat).SetString(encValue); !ok {
+			return fmt.Errorf("invalid big.Rat :%s", encValue)
+		} else {
+			value.Set(reflect.ValueOf(r))
 		}
 	default:
+		if value.CanAddr() {
+			if sc, ok := value.Addr().Interface().(sql.Scanner); ok {
+				return scan(encValue, sc, c)
+			}
+		}
+		if _, ok := bytesOf(value); ok {
+			return setBytes(encValue, value, c)
+		}
 		return fmt.Errorf("invalid type :%T", value.Interface())
 	}
 	return nil
 }
+
+// scan 用sql.Scanner解码，空字符串作为NULL
+func scan(encValue string, sc sql.Scanner, c codec) error {
+	if encValue == "" {
+		return sc.Scan(nil)
+	}
+	//sql.NullTime不能从字符串转换，先解析为时间
+	if _, ok := sc.(*sql.NullTime); ok {
+		var t time.Time
+		if err := decode(encValue, reflect.ValueOf(&t).Elem(), c); err != nil {
+			return err
+		}
+		return sc.Scan(t)
+	}
+	return sc.Scan(encValue)
+}
+
+// register 处理类型注册行，同一版本只能用相同的属性重复注册
+func (t *Decoder) register(values []string) error {
+	if len(values) < 3 {
+		return ErrTypeLine
+	}
+	ty, err := parseType(values[1], values[2])
+	if err != nil {
+		return err
+	}
+	columns := values[3:]
+	old, ok := t.types[ty]
+	if ok && ty.Version > 0 && !equalStrings(old, columns) {
+		return fmt.Errorf("the type %s redefined with different props %#v", ty, columns)
+	}
+	if !ok && t.MaxTypes > 0 && len(t.types) >= t.MaxTypes {
+		return ErrTooManyTypes
+	}
+	t.types[ty] = columns
+	t.currentType = &ty
+	return nil
+}
+
+// reference 处理类型引用行，不带版本号时引用最高的版本
+func (t *Decoder) reference(values []string) error {
+	if len(values) < 3 {
+		return ErrTypeLine
+	}
+	ty, err := parseType(values[1], values[2])
+	if err != nil {
+		return err
+	}
+	if ty.Version == 0 {
+		found := false
+		for tK := range t.types {
+			if tK.PkgPath == ty.PkgPath && tK.Name == ty.Name && (!found || tK.Version > ty.Version) {
+				ty, found = tK, true
+			}
+		}
+		if !found {
+			return fmt.Errorf("the type %s not found", ty)
+		}
+	} else if _, ok := t.types[ty]; !ok {
+		return fmt.Errorf("the type %s not found", ty)
+	}
+	t.currentType = &ty
+	return nil
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// A Row is one data record of a typed TT file together with the type it was
+// registered under, as returned by DecodeRow and written by Encoder.EncodeRow.
+type Row struct {
+	PkgPath string
+	Name    string
+	Columns []string
+	Values  []string
+}
+
+// Reader returns the underlying Reader, so that its fields can be changed
+// before the first call to Decode.
+func (t *Decoder) Reader() *Reader {
+	return t.reader
+}
+
+// lineError 返回当前记录所在位置的错误，出错的记录已经读完，可以继续读取下一条
+func (t *Decoder) lineError(err error) error {
+	line, column := t.reader.FieldPos(0)
+	return &ParseError{Line: line, Column: column, Err: err}
+}
+
+// isContextError 返回err是否是ctx结束的错误
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// readLine 读取一行，先返回replay中的行；记录时把读取的行和错误保存在block中，
+// ctx结束的错误除外，被放弃的读取由Reader在下一次读取时返回
+func (t *Decoder) readLine(read func() ([]string, []string, error)) ([]string, []string, error) {
+	var l readLine
+	if len(t.replay) > 0 {
+		l, t.replay = t.replay[0], t.replay[1:]
+	} else {
+		l.values, l.formats, l.err = read()
+		if len(l.values) > 0 {
+			l.line, _ = t.reader.FieldPos(0)
+		}
+	}
+	if len(l.values) > 0 {
+		t.line = l.line
+	}
+	if t.recording && (l.values != nil || l.formats != nil || l.err != nil && !isContextError(l.err)) {
+		t.block = append(t.block, l)
+	}
+	return l.values, l.formats, l.err
+}
+
+// readBlock 读取vtype的数据行和其子记录，不解码，数据有错误时停止，由解码时报告
+func (t *Decoder) readBlock(vtype reflect.Type, read func() ([]string, []string, error)) error {
+	values, formats, err := t.next(read)
+	if err != nil {
+		return err
+	}
+	for i, col := range t.types[*t.currentType] {
+		name, _ := parseTag(col)
+		f, err := findField(vtype, name)
+		if err != nil || f == nil {
+			return nil
+		}
+		ft := vtype.FieldByIndex(f.index).Type
+		if !isChildSlice(ft) || t.Absent != "" && formats[i] == "" && values[i] == t.Absent {
+			continue
+		}
+		n, err := strconv.Atoi(values[i])
+		if err != nil || n < 0 {
+			return nil
+		}
+		et := ft.Elem()
+		if et.Kind() == reflect.Ptr {
+			et = et.Elem()
+		}
+		for j := 0; j < n; j++ {
+			if err := t.readBlock(et, read); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// next 用read读取下一个数据行，处理其间的类型行，返回数据和各字段的引用方式
+func (t *Decoder) next(read func() ([]string, []string, error)) ([]string, []string, error) {
+	if t.err != nil {
+		return nil, nil, t.err
+	}
+	for {
+		values, formats, err := t.readLine(read)
+		//最后一行没有换行符时，数据和EOF一起返回
+		if err != nil && (err != io.EOF || values == nil) {
+			return nil, nil, err
+		}
+		//空行忽略，继续
+		if values == nil {
+			continue
+		}
+		if values[0] == "*" && formats[0] != "" {
+			//注册类型
+			if err := t.register(values); err != nil {
+				return nil, nil, t.lineError(err)
+			}
+		} else if values[0] == "@" && formats[0] != "" {
+			//引用类型
+			if err := t.reference(values); err != nil {
+				return nil, nil, t.lineError(err)
+			}
+		} else {
+			//读取到数据
+			if t.currentType == nil {
+				return nil, nil, t.lineError(fmt.Errorf("current type is empty"))
+			}
+			typeColumns := t.types[*t.currentType]
+			if len(values) != len(typeColumns) {
+				return nil, nil, t.lineError(fmt.Errorf("%w, has %d fields, type %s has %d props", ErrFieldCount, len(values), t.currentType, len(typeColumns)))
+			}
+			t.records++
+			return values, formats, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+// DecodeRow reads the next data record without mapping it to a struct. The
+// Columns of the returned Row are shared with later rows of the same type and
+// must not be modified.
+func (t *Decoder) DecodeRow() (*Row, error) {
+	values, _, err := t.next(t.reader.ReadWithFormat)
+	if err != nil {
+		return nil, err
+	}
+	return &Row{
+		PkgPath: t.currentType.PkgPath,
+		Name:    t.currentType.Name,
+		Columns: t.types[*t.currentType],
+		Values:  values,
+	}, nil
+}
+
 func (t *Decoder) Decode(v interface{}) error {
+	return t.decodeWith(v, t.reader.ReadWithFormat)
+}
+
+// decodeWith 用read读取下一个数据行，解码到v中
+func (t *Decoder) decodeWith(v interface{}, read func() ([]string, []string, error)) error {
+	if err := t.readAhead(v, read); err != nil {
+		return err
+	}
+	return t.decodeRecord(v, read)
+}
+
+// readAhead 先读取v的整个记录块，再从读取的行解码，读取时ctx结束不会改变v。
+// ctx结束时读取的行保留，类型和记录数恢复到记录块之前，下一次读取从头重新解析
+func (t *Decoder) readAhead(v interface{}, read func() ([]string, []string, error)) error {
+	vtype := reflect.TypeOf(v)
+	if vtype == nil || vtype.Kind() != reflect.Ptr || vtype.Elem().Kind() != reflect.Struct {
+		//由decodeRecord报告
+		return nil
+	}
+	records, currentType := t.records, t.currentType
+	t.block, t.recording = nil, true
+	err := t.readBlock(vtype.Elem(), read)
+	t.replay = append(t.block, t.replay...)
+	t.block, t.recording = nil, false
+	t.records, t.currentType = records, currentType
+	if isContextError(err) {
+		return err
+	}
+	return nil
+}
+
+// decodeRecord 用read读取下一个数据行和其子记录，解码到v中
+func (t *Decoder) decodeRecord(v interface{}, read func() ([]string, []string, error)) error {
 	vtype := reflect.TypeOf(v)
 	value := reflect.ValueOf(v)
 	if vtype.Kind() != reflect.Ptr {
@@ -145,58 +527,128 @@ func (t *Decoder) Decode(v interface{}) error {
 		return fmt.Errorf("param v must is ptr to struct")
 	}
 
-	var values, formats []string
-	for {
-		var err error
-		values, formats, err = t.reader.ReadWithFormat()
-		if err != nil {
+	if t.Absent != "" {
+		r := t.reader
+		w := &Writer{Comma: r.Comma, Comment: r.Comment, Dialect: r.Dialect, Delimiter: r.Delimiter, Terminator: r.Terminator}
+		if err := checkAbsent(t.Absent, w); err != nil {
 			return err
 		}
-		//空行忽略，继续
-		if values != nil {
-			if values[0] == "*" && formats[0] == "`" {
-				//注册类型
-				t.currentType = &ttType{values[1], values[2]}
-				t.types[t.currentType] = values[3:]
-			} else if values[0] == "@" && formats[0] == "`" {
-				//引用类型
-				var foundType *ttType = nil
-				for tK, _ := range t.types {
-					if tK.PkgPath == values[1] && tK.Name == values[2] {
-						foundType = tK
-						break
-					}
-				}
-				if foundType != nil {
-					t.currentType = foundType
-				} else {
-					return fmt.Errorf("the type %s.%s not found", values[1], values[2])
-				}
-			} else {
-				break //读取到数据
+	}
+	values, formats, err := t.next(read)
+	if err != nil {
+		return err
+	}
+	record, line := t.records, t.line
+	typeColumns := t.types[*t.currentType]
+	absent := func(i int) bool {
+		return t.Absent != "" && formats[i] == "" && values[i] == t.Absent
+	}
+	//数据行后面有子记录时，出错后不能再对齐记录
+	fail := func(err error) error {
+		for i, col := range typeColumns {
+			name, _ := parseTag(col)
+			f, _ := findField(vtype, name)
+			if f != nil && !absent(i) && isChildSlice(vtype.FieldByIndex(f.index).Type) && values[i] != "0" {
+				t.err = fmt.Errorf("%s: %w", t.currentType, err)
+				return t.err
 			}
 		}
+		return err
 	}
-
-	if t.currentType == nil {
-		return fmt.Errorf("current type is empty")
-	}
-
-	typeColumns := t.types[t.currentType]
-	if len(values) != len(typeColumns) {
-		return fmt.Errorf("the value %#v length not equ type prop name :%#v", values, typeColumns)
+	c := t.codec()
+	//切片属性的子记录在数据行之后读取
+	type childSlice struct {
+		name  string
+		value reflect.Value
+		count int
 	}
+	var slices []childSlice
 	for i, fieldStringValue := range values {
-		idx, err := findPropByName(vtype, typeColumns[i])
+		//未引用的缺失标记，保留原来的值
+		if absent(i) {
+			continue
+		}
+		//属性名称后面可以带有标签形式的选项，如ExportRows写入的bytes
+		name, colOpts := parseTag(typeColumns[i])
+		f, err := findField(vtype, name)
 		if err != nil {
-			return err
+			return fail(err)
 		}
-		if idx == nil {
-			return fmt.Errorf("can't find the prop:%s at type %T", typeColumns[i], v)
+		if f == nil {
+			return fail(fmt.Errorf("can't find the prop:%s at type %T", name, v))
 		}
-		if err := decode(fieldStringValue, value.FieldByIndex(idx)); err != nil {
+		fv, err := fieldValueAlloc(value, f.index)
+		if err != nil {
+			return fail(err)
+		}
+		//子记录的个数不经过钩子
+		if isChildSlice(fv.Type()) {
+			n, err := strconv.Atoi(fieldStringValue)
+			if err != nil || n < 0 {
+				return fail(fmt.Errorf("invalid count of child records %s: %q", name, fieldStringValue))
+			}
+			slices = append(slices, childSlice{name, fv, n})
+			continue
+		}
+		//接口属性中的具体值不经过钩子
+		if fv.Kind() != reflect.Interface || fieldStringValue == "" {
+			fieldStringValue, err = runHooks(t.FieldHooks, vtype, name, fieldStringValue)
+			if err != nil {
+				return fail(err)
+			}
+		}
+		if err := decode(fieldStringValue, fv, c.with(f.opts).with(colOpts)); err != nil {
+			return fail(err)
+		}
+	}
+	//子记录的校验错误收集后继续读取，保持在下一个记录
+	var errs ValidationErrors
+	for _, cs := range slices {
+		//没有子记录时为nil
+		s := reflect.Zero(cs.value.Type())
+		if cs.count > 0 {
+			s = reflect.MakeSlice(cs.value.Type(), cs.count, cs.count)
+		}
+		for j := 0; j < cs.count; j++ {
+			elem := s.Index(j)
+			if elem.Kind() == reflect.Ptr {
+				elem.Set(reflect.New(elem.Type().Elem()))
+			} else {
+				elem = elem.Addr()
+			}
+			err := t.decodeRecord(elem.Interface(), read)
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			var ve ValidationErrors
+			if errors.As(err, &ve) {
+				errs = append(errs, ve...)
+			} else if isContextError(err) {
+				//没有读取完的记录块可以重新读取，不需要记住错误
+				return err
+			} else if err != nil {
+				if t.err == nil {
+					t.err = fmt.Errorf("%s[%d]: %w", cs.name, j, err)
+				}
+				return t.err
+			}
+		}
+		cs.value.Set(s)
+	}
+	if ad, ok := v.(AfterDecoder); ok {
+		if err := ad.AfterDecodeTT(); err != nil {
 			return err
 		}
 	}
-	return nil
+	err = t.validate(v, value, record, line)
+	if errs == nil {
+		return err
+	}
+	var ve ValidationErrors
+	if errors.As(err, &ve) {
+		errs = append(ve, errs...)
+	} else if err != nil {
+		return err
+	}
+	return errs
 }
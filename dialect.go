@@ -0,0 +1,116 @@
+package gott
+
+import (
+	"errors"
+	"strings"
+)
+
+// Errors of a Reader with the RFC4180 or the Excel Dialect.
+var (
+	// ErrBareQuote is returned for a " in a field that is not quoted, Excel
+	// takes it as an ordinary character.
+	ErrBareQuote = errors.New("bare \" in non-quoted-field")
+	// ErrDoubleQuote is returned for text after the closing " of a field.
+	ErrDoubleQuote = errors.New("extraneous \" in field")
+)
+
+// A Dialect is the quoting syntax of a Reader or a Writer.
+type Dialect int
+
+const (
+	// DialectTT quotes fields with backticks and ^id^ heredocs (the default).
+	DialectTT Dialect = iota
+	// DialectRFC4180 quotes fields with double quotes as in RFC 4180, a " in
+	// a quoted field being written as "". Backticks and ^ are ordinary
+	// characters. With Comma set to ',' it reads and writes CSV.
+	DialectRFC4180
+	// DialectExcel is the tab separated text spreadsheets copy to the
+	// clipboard: DialectRFC4180 with records terminated by \r\n, where a Reader
+	// takes a " that does not delimit a field as an ordinary character.
+	DialectExcel
+)
+
+// readDoubleQuoted 读取"引用的字段，开始的"已经读取，start是字段开始的位置
+func (dec *Reader) readDoubleQuoted(start position) (string, error) {
+	raw := strings.Builder{}
+	value := strings.Builder{}
+	dec.setLimit(1, true)
+	for {
+		str, err := dec.r.ReadString('"')
+		if err != nil {
+			return "", dec.quotedError(start, err)
+		}
+		raw.WriteString(str)
+		value.WriteString(str[:len(str)-1])
+		next, err := dec.r.Peek(1)
+		if err == nil && next[0] == '"' {
+			//""表示一个"
+			dec.r.ReadRune()
+			raw.WriteByte('"')
+			value.WriteByte('"')
+			continue
+		}
+		//宽松模式下，不在字段结尾的"是普通字符
+		if dec.Dialect == DialectExcel && err == nil && !dec.atFieldEnd() {
+			value.WriteByte('"')
+			continue
+		}
+		break
+	}
+	s := raw.String()
+	if _, err := dec.checkUTF8(s[:len(s)-1], start.advance(`"`)); err != nil {
+		return "", err
+	}
+	if dec.InvalidUTF8 == UTF8Replace {
+		return replaceUTF8(value.String()), nil
+	}
+	return value.String(), nil
+}
+
+// peekFieldEnd 是判断字段结尾时最多预读的字节数，包括填充的空格
+const peekFieldEnd = 256
+
+// atFieldEnd 检查后面是否是字段的结尾，不读取任何字符。先只看已有的输入，
+// 不能确定时才等待更多的输入，以免跟随的文件在文件尾阻塞
+func (dec *Reader) atFieldEnd() bool {
+	ends := []string{dec.delimiter()}
+	if dec.Terminator != "" {
+		ends = append(ends, dec.Terminator)
+	} else {
+		ends = append(ends, "\n", "\r\n")
+	}
+	buf := peekAvailable(dec.r.r, peekFieldEnd)
+	for {
+		s := string(buf)
+		if dec.TrimPadding {
+			s = strings.TrimLeft(s, " ")
+		}
+		pending := s == ""
+		for _, end := range ends {
+			if strings.HasPrefix(s, end) {
+				return true
+			}
+			//可能是没有读完的分隔符或结束符
+			pending = pending || strings.HasPrefix(end, s)
+		}
+		if !pending || len(buf) >= peekFieldEnd {
+			return false
+		}
+		more, err := dec.r.Peek(len(buf) + 1)
+		if err != nil {
+			//输入结束
+			return s == ""
+		}
+		buf = more
+	}
+}
+
+// dialectFormat 返回非TT方言的引用格式，需要引用时为"
+func (w *Writer) dialectFormat(str string) string {
+	if w.Quote == QuoteBacktick || str != "" &&
+		(strings.Contains(str, `"`) || w.hasSeparator(str) ||
+			w.Comment != 0 && strings.HasPrefix(str, string(w.Comment))) {
+		return `"`
+	}
+	return ""
+}
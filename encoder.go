@@ -1,154 +1,498 @@
 package gott
 
 import (
-	"encoding/base64"
+	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"io"
+	"math/big"
 	"reflect"
+	"strconv"
 	"time"
 )
 
+// An Encoder writes structs to a typed TT file, see Decoder for the format.
+//
+// The exported fields can be changed to customize the details before the
+// first call to Encode.
+//
+// TimeFormat is the format of time.Time values, a layout for time.Format or
+// one of TimeUnix, TimeUnixMilli, TimeUnixMicro and TimeUnixNano. It defaults
+// to time.RFC3339Nano, which keeps the nanoseconds and the zone offset. A
+// field can override it with the time option of its tag. Monotonic clock
+// readings are never written.
+//
+// Location, if not nil, is the location times are converted to before they
+// are formatted.
+//
+// time.Duration values are written as by Duration.String.
+//
+// BytesFormat is the format of []byte and [N]byte values, one of BytesBase64
+// (the default), BytesBase64URL, BytesBase32, BytesHex and BytesRaw. A field
+// can override it with the bytes option of its tag.
+//
+// FloatFormat is the format of float32, float64, *big.Float and *big.Rat
+// values: a format character of strconv.FormatFloat ('e', 'f' or 'g')
+// optionally followed by the precision, e.g. "f2". Without a precision the
+// shortest representation that reads back exactly is written. It defaults to
+// "g"; "f" avoids the exponent notation. A field can override it with the
+// float option of its tag. NaN and infinities are written as the NaN, PosInf
+// and NegInf tokens. A *big.Rat is written as an exact decimal when it has one
+// and as a fraction a/b otherwise, unless a fixed precision is given.
+// *big.Int values are written in decimal.
+//
+// Absent, if not empty, is the marker EncodePatch writes for the fields that
+// did not change, see Decoder. Values equal to it are then always quoted, so
+// that they are not read as the marker.
+//
+// FieldHooks transform the text of the fields written by Encode, see
+// FieldHook. A value implementing BeforeEncoder is prepared first.
 type Encoder struct {
+	TimeFormat  string
+	Location    *time.Location
+	BytesFormat string
+	FloatFormat string
+	Absent      string
+	FieldHooks  []FieldHook
 	writer      *Writer
-	types       map[*ttType][]string
+	types       map[ttType][]string
+	prevTypes   map[ttType][]string //之前的分片注册过的类型
 	currentType *ttType
+	records     int        //已经写入的数据行数
+	pending     chan error //EncodeContext放弃的写入
+	pendingErr  error      //放弃的写入的错误，由下一次写入返回
 }
 
 func NewEncoder(w io.Writer) *Encoder {
-	return &Encoder{NewWriter(w), map[*ttType][]string{}, nil}
+	return &Encoder{writer: NewWriter(w), types: map[ttType][]string{}}
 }
-func encode(value interface{}) (result string, err error) {
+
+// NewAppendEncoder returns an Encoder that appends to a typed TT file whose
+// records have all been read by dec, up to io.EOF; w must write at the end of
+// that file. The types registered in the file are not registered again, and
+// a type whose props changed, e.g. after a program upgrade, is registered with
+// the next version number, so that the whole file still decodes. The file
+// must end with a line break, as the files written by an Encoder do.
+func NewAppendEncoder(w io.Writer, dec *Decoder) *Encoder {
+	enc := NewEncoder(w)
+	for ty, cols := range dec.types {
+		enc.types[ty] = append([]string(nil), cols...)
+	}
+	if dec.currentType != nil {
+		current := *dec.currentType
+		enc.currentType = &current
+	}
+	return enc
+}
+
+func (enc *Encoder) codec() codec {
+	return codec{timeFormat: enc.TimeFormat, location: enc.Location,
+		bytesFormat: enc.BytesFormat, floatFormat: enc.FloatFormat}
+}
+
+func encode(value interface{}, c codec) (result string, err error) {
 	switch tv := value.(type) {
 	case nil:
 		result = ""
 	case string:
 		result = tv
-	case float32, float64, int, int64:
+	case float32:
+		result, err = formatFloat(float64(tv), 32, c)
+	case float64:
+		result, err = formatFloat(tv, 64, c)
+	case int, int64:
 		result = fmt.Sprintf("%v", tv)
+	case *big.Int:
+		if tv != nil {
+			result = tv.String()
+		}
+	case *big.Float:
+		if tv != nil {
+			result, err = formatBigFloat(tv, c)
+		}
+	case *big.Rat:
+		if tv != nil {
+			result, err = formatRat(tv, c)
+		}
 	case time.Time:
-		result = tv.Format(time.RFC3339)
+		result = formatTime(tv, c)
+	case time.Duration:
+		result = tv.String()
+	case bool:
+		result = strconv.FormatBool(tv)
 	case []byte:
-		result = base64.StdEncoding.EncodeToString(tv)
+		result, err = encodeBytes(tv, c)
+	case driver.Valuer:
+		//sql.NullString等类型，用其驱动值编码，NULL为空字符串
+		var v driver.Value
+		if v, err = tv.Value(); err == nil {
+			result, err = encode(v, c)
+		}
 	default:
-		err = fmt.Errorf("invalid type :%T", value)
+		if b, ok := bytesOf(reflect.ValueOf(value)); ok {
+			result, err = encodeBytes(b, c)
+		} else {
+			err = fmt.Errorf("invalid type :%T", value)
+		}
 	}
 	return
 }
-func (enc *Encoder) findType(ty reflect.Type) *ttType {
-	pkgPath := ty.PkgPath()
-	tyName := ty.Name()
-	for sty, _ := range enc.types {
+
+// findType 在types中查找属性相同的已注册类型，找不到时返回nil和该类型已用的最高版本号
+func findType(types map[ttType][]string, pkgPath, tyName string, columns []string) (*ttType, int) {
+	maxVersion := 0
+	for sty, cols := range types {
 		if sty.PkgPath == pkgPath && sty.Name == tyName {
-			return sty
+			if equalStrings(cols, columns) {
+				return &sty, sty.Version
+			}
+			if sty.Version > maxVersion {
+				maxVersion = sty.Version
+			}
 		}
 	}
-	return nil
+	return nil, maxVersion
 }
 
-//获取指定结构的属性名称和属性值,重名的自动去除
-func getStructValues(obj reflect.Value) (fieldNames []string, fieldValues []interface{}, err error) {
-	appendNoDup := func(name string, value interface{}) {
-		bFound := false
-		for _, vv := range fieldNames {
-			if vv == name {
-				bFound = true
-				break
-			}
-		}
-		if !bFound {
-			fieldNames = append(fieldNames, name)
-			fieldValues = append(fieldValues, value)
-		}
-
-		return
+//获取指定结构的属性名称、属性值和标签选项,同名属性的规则见typeFields,
+//经过空的嵌入指针的属性值为nil，接口类型的属性中注册过的具体值为variant，没有注册时返回ErrNotRegistered
+func getStructValues(obj reflect.Value) (fieldNames []string, fieldValues []interface{}, fieldOpts []tagOptions, err error) {
+	fields, err := typeFields(obj.Type())
+	if err != nil {
+		return nil, nil, nil, err
 	}
-	fieldNames = []string{}
-	fieldValues = []interface{}{}
-	ty := obj.Type()
-	for i := 0; i < obj.NumField(); i++ {
-		f := obj.Field(i)
-		t := ty.Field(i)
-		if !f.CanInterface() { //unexported
-			continue
-		}
-		if t.Anonymous && f.Kind() == reflect.Struct {
-			ns, vs, e := getStructValues(f)
-			if err != nil {
-				fieldNames, fieldValues, err = ns, vs, e
-				return
-			}
-			if len(ns) > 0 {
-				//排重后添加
-				for si, sv := range ns {
-					appendNoDup(sv, vs[si])
+	for _, f := range fields {
+		var value interface{}
+		if v, ok := fieldValue(obj, f.index); ok {
+			value = v.Interface()
+			if v.Kind() == reflect.Interface && !v.IsNil() {
+				name, ok := registeredName(v.Elem())
+				if !ok {
+					return nil, nil, nil, fmt.Errorf("field %s: %w: %s", f.name, ErrNotRegistered, v.Elem().Type())
 				}
+				value = variant{name, v.Elem()}
 			}
-		} else {
-			appendNoDup(t.Name, f.Interface())
 		}
+		fieldNames = append(fieldNames, f.name)
+		fieldValues = append(fieldValues, value)
+		fieldOpts = append(fieldOpts, f.opts)
 	}
 	return
 }
 
-func (enc *Encoder) Encode(v interface{}) error {
-	value := reflect.ValueOf(v)
-	if value.Kind() == reflect.Ptr {
-		value = value.Elem()
+// Writer returns the underlying Writer, so that its fields can be changed
+// before the first call to Encode. It waits for a writing abandoned by
+// EncodeContext, whose error is still returned by the next write.
+func (enc *Encoder) Writer() *Writer {
+	enc.settle()
+	return enc.writer
+}
+
+// registerType 在类型没有注册或属性变化时写入类型注册行，返回注册的类型
+func (enc *Encoder) registerType(pkgPath, name string, columns []string) (*ttType, error) {
+	encType, maxVersion := findType(enc.types, pkgPath, name, columns)
+	if encType != nil {
+		return encType, nil
 	}
-	vtype := value.Type()
-	if vtype.Kind() != reflect.Struct {
-		return fmt.Errorf("param v must is ptr to struct")
+	//注册新类型，属性变化时用新的版本号重新注册，
+	//之前的分片注册过的类型保持原来的版本号
+	if prev, prevMax := findType(enc.prevTypes, pkgPath, name, columns); prev != nil {
+		maxVersion = prev.Version - 1
+	} else if prevMax > maxVersion {
+		maxVersion = prevMax
+	}
+	encType = &ttType{
+		PkgPath: pkgPath,
+		Name:    name,
+		Version: maxVersion + 1,
 	}
-	columns, values, err := getStructValues(value)
+	line := append([]string{"*", encType.PkgPath, encType.typeName()}, columns...)
+	fmts := make([]string, len(line))
+	fmts[0] = "`"
+	if err := enc.writer.WriteWithFormat(line, fmts); err != nil {
+		return nil, err
+	}
+	enc.currentType = encType
+	enc.types[*encType] = append([]string(nil), columns...)
+	return encType, nil
+}
+
+// writeType 在需要时写入类型注册行或引用行
+func (enc *Encoder) writeType(pkgPath, name string, columns []string) error {
+	encType, err := enc.registerType(pkgPath, name, columns)
 	if err != nil {
 		return err
 	}
-
-	encType := enc.findType(vtype)
-	if encType == nil {
-		//注册新类型
-		encType = &ttType{
-			PkgPath: vtype.PkgPath(),
-			Name:    vtype.Name(),
-		}
-		line := append([]string{"*", encType.PkgPath, encType.Name}, columns...)
+	if enc.currentType == nil || *encType != *enc.currentType {
+		//引用类型
+		line := []string{"@", encType.PkgPath, encType.typeName()}
 		fmts := make([]string, len(line))
-		for i, _ := range line {
-			fmts[i] = ""
-		}
 		fmts[0] = "`"
 		if err := enc.writer.WriteWithFormat(line, fmts); err != nil {
 			return err
 		}
 		enc.currentType = encType
-		enc.types[enc.currentType] = columns
-	} else if encType != enc.currentType {
-		//引用类型
-		line := []string{"@", encType.PkgPath, encType.Name}
-		fmts := make([]string, len(line))
-		for i, _ := range line {
-			fmts[i] = ""
+	}
+	return nil
+}
+
+// writeLine 写入数据行，absent为true的字段写入未引用的缺失标记，
+// 和缺失标记相同的值需要引用
+func (enc *Encoder) writeLine(line []string, absent []bool) error {
+	fmts := enc.writer.formats(line)
+	for i, v := range line {
+		if absent != nil && absent[i] {
+			line[i], fmts[i] = enc.Absent, ""
+		} else if enc.Absent != "" && v == enc.Absent && fmts[i] == "" {
+			fmts[i] = "`"
 		}
-		fmts[0] = "`"
-		if err := enc.writer.WriteWithFormat(line, fmts); err != nil {
-			return err
+	}
+	return enc.writer.WriteWithFormat(line, fmts)
+}
+
+// writeValues 写入数据行，非美化输出时刷新缓存
+func (enc *Encoder) writeValues(line []string, absent []bool) error {
+	if err := enc.writeLine(line, absent); err != nil {
+		return err
+	}
+	//美化输出时需要缓存记录，由调用者刷新
+	if enc.writer.Pretty {
+		return nil
+	}
+	return enc.writer.Flush()
+}
+
+// EncodeRow writes row without reflecting on a struct. The type header is
+// registered or referenced from row.PkgPath, row.Name and row.Columns exactly
+// as Encode does for a struct type.
+func (enc *Encoder) EncodeRow(row *Row) error {
+	if err := enc.wait(); err != nil {
+		return err
+	}
+	if err := checkRow(row); err != nil {
+		return err
+	}
+	return enc.write(row.PkgPath, row.Name, row.Columns, row.Values, nil)
+}
+
+// checkRow 检查数据和属性的个数是否一致
+func checkRow(row *Row) error {
+	if len(row.Values) != len(row.Columns) {
+		return fmt.Errorf("the value %#v length not equ type prop name :%#v", row.Values, row.Columns)
+	}
+	return nil
+}
+
+// write 写入类型行和数据行
+func (enc *Encoder) write(pkgPath, name string, columns, line []string, absent []bool) error {
+	if err := enc.writeType(pkgPath, name, columns); err != nil {
+		return err
+	}
+	if err := enc.writeValues(line, absent); err != nil {
+		return err
+	}
+	enc.records++
+	return nil
+}
+
+// structRecord 是结构编码后的数据行，切片属性的子记录依次写在数据行之后
+type structRecord struct {
+	pkgPath  string
+	name     string
+	columns  []string
+	line     []string
+	opts     []tagOptions
+	counts   []bool          //属性是子记录的个数
+	variants []*structRecord //接口属性中的具体值，写入时编码为属性的文本
+	children []*structRecord
+}
+
+// nested 返回第i个属性是否是子记录的个数或接口属性中的具体值，它们不经过钩子
+func (rec *structRecord) nested(i int) bool {
+	return rec.counts[i] || rec.variants[i] != nil
+}
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	valuerType  = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+)
+
+// isChildSlice 返回t是否是结构或结构指针的切片，其元素作为子记录写入，
+// 作为单个值编码的结构(time.Time、math/big、driver.Valuer、sql.Scanner)和没有属性的结构除外
+func isChildSlice(t reflect.Type) bool {
+	if t.Kind() != reflect.Slice {
+		return false
+	}
+	t = t.Elem()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == timeType || t.PkgPath() == "math/big" {
+		return false
+	}
+	pt := reflect.PtrTo(t)
+	if pt.Implements(valuerType) || pt.Implements(scannerType) {
+		return false
+	}
+	//属性冲突的错误在编码时报告
+	fields, err := typeFields(t)
+	return err != nil || len(fields) > 0
+}
+
+// structLine 把结构v编码为数据行，切片属性写入子记录的个数，并编码其子记录
+func (enc *Encoder) structLine(v interface{}) (*structRecord, error) {
+	return enc.encodeStruct(v, true)
+}
+
+// encodeStruct 同structLine，hooks为false时不调用BeforeEncodeTT和属性钩子，只读取v
+func (enc *Encoder) encodeStruct(v interface{}, hooks bool) (*structRecord, error) {
+	value := reflect.ValueOf(v)
+	if value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+	if !value.IsValid() || value.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("param v must is ptr to struct")
+	}
+	vtype := value.Type()
+	if be, ok := v.(BeforeEncoder); ok && hooks {
+		if err := be.BeforeEncodeTT(); err != nil {
+			return nil, err
 		}
-		enc.currentType = encType
 	}
-	//写入数据
-	line := []string{}
-	for _, sv := range values {
-		if str, err := encode(sv); err != nil {
-			return err
+	columns, values, opts, err := getStructValues(value)
+	if err != nil {
+		return nil, err
+	}
+	rec := &structRecord{pkgPath: vtype.PkgPath(), name: vtype.Name(),
+		columns: columns, opts: opts, counts: make([]bool, len(values)),
+		variants: make([]*structRecord, len(values))}
+	c := enc.codec()
+	for i, sv := range values {
+		var str string
+		if rv := reflect.ValueOf(sv); sv != nil && isChildSlice(rv.Type()) {
+			rec.counts[i] = true
+			str = strconv.Itoa(rv.Len())
+			for j := 0; j < rv.Len(); j++ {
+				elem := rv.Index(j)
+				if elem.Kind() == reflect.Struct {
+					elem = elem.Addr()
+				}
+				child, err := enc.encodeStruct(elem.Interface(), hooks)
+				if err != nil {
+					return nil, fmt.Errorf("%s[%d]: %w", columns[i], j, err)
+				}
+				rec.children = append(rec.children, child)
+			}
+		} else if vr, ok := sv.(variant); ok {
+			if rec.variants[i], err = enc.variantLine(vr); err != nil {
+				return nil, fmt.Errorf("%s: %w", columns[i], err)
+			}
 		} else {
-			line = append(line, str)
+			str, err = encode(sv, c.with(opts[i]))
+		}
+		if err == nil && hooks && !rec.nested(i) {
+			str, err = runHooks(enc.FieldHooks, vtype, columns[i], str)
+		}
+		if err != nil {
+			return nil, err
 		}
+		rec.line = append(rec.line, str)
 	}
-	if err := enc.writer.Write(line); err != nil {
+	return rec, nil
+}
+
+// writeStruct 写入结构的数据行和其后的子记录，flush为true且非美化输出时刷新缓存
+func (enc *Encoder) writeStruct(rec *structRecord, absent []bool, flush bool) error {
+	if err := enc.writeVariants(rec); err != nil {
 		return err
 	}
-	if err := enc.writer.Flush(); err != nil {
+	if err := enc.writeType(rec.pkgPath, rec.name, rec.columns); err != nil {
 		return err
 	}
-	return nil
+	if err := enc.writeLine(rec.line, absent); err != nil {
+		return err
+	}
+	enc.records++
+	for _, child := range rec.children {
+		if err := enc.writeStruct(child, nil, false); err != nil {
+			return err
+		}
+	}
+	//美化输出时需要缓存记录，由调用者刷新
+	if !flush || enc.writer.Pretty {
+		return nil
+	}
+	return enc.writer.Flush()
+}
+
+// Encode writes the struct v, registering or referencing its type first. A
+// field that is a slice of structs, or of pointers to structs, is written as
+// the number of elements, and the elements follow the record as child
+// records of their own type, each followed by its own children. The Decoder
+// reads them back into the slice, nil when there are none; the plain Reader
+// sees ordinary records. If a record of such a block can't be decoded, the
+// rest of the block can't be told from the following records, and every later
+// call of the Decoder returns the same error. Slices of types written as a
+// single value, like time.Time, are not child records.
+func (enc *Encoder) Encode(v interface{}) error {
+	if err := enc.wait(); err != nil {
+		return err
+	}
+	rec, err := enc.structLine(v)
+	if err != nil {
+		return err
+	}
+	return enc.writeStruct(rec, nil, true)
+}
+
+// EncodePatch writes the struct v as a patch against base, a value of the
+// same type: the fields whose text is the same as in base are written as the
+// Absent marker, so that Decode leaves them untouched. Fields with the key
+// option in their tag, as in
+//
+//	ID int `tt:",key"`
+//
+// are always written, so that the patched value can be identified. The slices
+// of child records and the values of interface fields are always written in
+// full. base is only read: neither BeforeEncodeTT nor the FieldHooks are
+// applied to it, so a field they change in v is written.
+//
+// The Absent marker must read back as itself when written unquoted: the
+// Writer must write it plain with QuoteMinimal under its Dialect, Delimiter,
+// Terminator and Comment, and it can't be * or @.
+func (enc *Encoder) EncodePatch(v, base interface{}) error {
+	if err := enc.wait(); err != nil {
+		return err
+	}
+	if enc.Absent == "" {
+		return fmt.Errorf("the Absent marker is not set")
+	}
+	if err := checkAbsent(enc.Absent, enc.writer); err != nil {
+		return err
+	}
+	vtype, btype := reflect.TypeOf(v), reflect.TypeOf(base)
+	if vtype != nil && vtype.Kind() == reflect.Ptr {
+		vtype = vtype.Elem()
+	}
+	if btype != nil && btype.Kind() == reflect.Ptr {
+		btype = btype.Elem()
+	}
+	if btype != vtype {
+		return fmt.Errorf("the base %s is not of type %s", btype, vtype)
+	}
+	rec, err := enc.structLine(v)
+	if err != nil {
+		return err
+	}
+	baseRec, err := enc.encodeStruct(base, false)
+	if err != nil {
+		return err
+	}
+	absent := make([]bool, len(rec.line))
+	for i := range rec.line {
+		_, key := rec.opts[i].Get("key")
+		absent[i] = !key && !rec.nested(i) && rec.line[i] == baseRec.line[i]
+	}
+	return enc.writeStruct(rec, absent, true)
 }
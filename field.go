@@ -0,0 +1,195 @@
+package gott
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// ErrAmbiguousField is returned when a struct has several fields of the same
+// name that none of the rules below can choose between.
+var ErrAmbiguousField = errors.New("ambiguous field")
+
+// field 是结构中读写的一个属性
+type field struct {
+	name   string
+	index  []int
+	opts   tagOptions
+	tagged bool //名称来自标签
+}
+
+// structFields 缓存结构类型的属性
+var structFields sync.Map // map[reflect.Type]structInfo
+
+type structInfo struct {
+	fields []field
+	err    error
+}
+
+// typeFields 返回结构t的属性，Encoder和Decoder使用相同的规则，和encoding/json一致：
+// 只有导出的属性，名称取tt标签的名称，没有时取属性名，标签为"-"的忽略；
+// 没有标签名称的嵌入结构或结构指针展开其属性，包括未导出的结构类型；
+// 同名的属性中层次最浅的优先，同一层次中有标签名称的优先，仍不能确定时返回ErrAmbiguousField。
+// 属性按照在结构中的顺序排列，嵌入结构的属性在嵌入的位置。
+func typeFields(t reflect.Type) ([]field, error) {
+	if info, ok := structFields.Load(t); ok {
+		return info.(structInfo).fields, info.(structInfo).err
+	}
+	fields, err := resolveFields(t)
+	structFields.Store(t, structInfo{fields, err})
+	return fields, err
+}
+
+func resolveFields(t reflect.Type) ([]field, error) {
+	type embedded struct {
+		typ   reflect.Type
+		index []int
+	}
+	var all []field
+	next := []embedded{{typ: t}}
+	visited := map[reflect.Type]bool{}
+	for len(next) > 0 {
+		current := next
+		next = nil
+		//同一层次多次嵌入的类型，其属性重复加入，以便报告冲突
+		count := map[reflect.Type]int{}
+		for _, e := range current {
+			count[e.typ]++
+		}
+		for _, e := range current {
+			if visited[e.typ] {
+				continue
+			}
+			visited[e.typ] = true
+			for i := 0; i < e.typ.NumField(); i++ {
+				sf := e.typ.Field(i)
+				tag := sf.Tag.Get("tt")
+				if tag == "-" {
+					continue
+				}
+				name, opts := parseTag(tag)
+				index := append(append([]int{}, e.index...), i)
+				if sf.Anonymous {
+					ft := sf.Type
+					if ft.Kind() == reflect.Ptr {
+						ft = ft.Elem()
+					}
+					if name == "" && ft.Kind() == reflect.Struct {
+						for n := 0; n < count[e.typ]; n++ {
+							next = append(next, embedded{ft, index})
+						}
+						continue
+					}
+				}
+				if !sf.IsExported() {
+					continue
+				}
+				f := field{name: name, index: index, opts: opts, tagged: name != ""}
+				if name == "" {
+					f.name = sf.Name
+				}
+				for n := 0; n < count[e.typ]; n++ {
+					all = append(all, f)
+				}
+			}
+		}
+	}
+	byName := map[string][]field{}
+	for _, f := range all {
+		byName[f.name] = append(byName[f.name], f)
+	}
+	fields := []field{}
+	for name, fs := range byName {
+		f, ok := dominantField(fs)
+		if !ok {
+			return nil, fmt.Errorf("%w %s in %s", ErrAmbiguousField, name, t)
+		}
+		fields = append(fields, f)
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		a, b := fields[i].index, fields[j].index
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+	return fields, nil
+}
+
+// dominantField 从同名的属性中选出层次最浅的，同一层次有多个时选有标签名称的
+func dominantField(fs []field) (field, bool) {
+	depth := len(fs[0].index)
+	for _, f := range fs {
+		if len(f.index) < depth {
+			depth = len(f.index)
+		}
+	}
+	var found []field
+	for _, f := range fs {
+		if len(f.index) == depth {
+			found = append(found, f)
+		}
+	}
+	if len(found) == 1 {
+		return found[0], true
+	}
+	var tagged []field
+	for _, f := range found {
+		if f.tagged {
+			tagged = append(tagged, f)
+		}
+	}
+	if len(tagged) == 1 {
+		return tagged[0], true
+	}
+	return field{}, false
+}
+
+// findField 返回结构t中名称为name的属性，没有时返回nil
+func findField(t reflect.Type, name string) (*field, error) {
+	fields, err := typeFields(t)
+	if err != nil {
+		return nil, err
+	}
+	for i := range fields {
+		if fields[i].name == name {
+			return &fields[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// fieldValue 返回v中index位置的属性值，经过空的嵌入指针时返回false
+func fieldValue(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// fieldValueAlloc 返回v中index位置的属性值，为空的嵌入指针分配新值
+func fieldValueAlloc(v reflect.Value, index []int) (reflect.Value, error) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, fmt.Errorf("cannot set embedded pointer to unexported struct: %v", v.Type().Elem())
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, nil
+}
@@ -0,0 +1,172 @@
+package gott
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrFollowerClosed is returned by the reads of a Follower after Close.
+var ErrFollowerClosed = errors.New("follower closed")
+
+// errRestart 表示文件被截断或者被轮换，需要从新的内容开始解析
+var errRestart = errors.New("file truncated or rotated")
+
+// A Follower reads a TT file that other processes are appending records to,
+// like tail -f. At the end of the file it waits for more data instead of
+// returning io.EOF, so a record, including a multi-line quoted field, is only
+// returned once it is complete.
+//
+// The file is read from its beginning, so that the `*` lines of a typed file
+// are seen. When the file is truncated, or the name is given to a new file
+// (as by log rotation or a RotatingEncoder) and the old file is read to its
+// end, reading restarts at the beginning of the new content, with the types
+// registered so far forgotten; a record being read at that moment is lost.
+//
+// Poll is the interval at which the file is checked for new data. The
+// settings of Decoder and its Reader are kept on a restart. Reads block until
+// a record is available or Close is called, which makes them return
+// ErrFollowerClosed.
+type Follower struct {
+	Poll time.Duration
+	name string
+	mu   sync.Mutex //保护f和offset，Close可以在其他goroutine调用
+	f    *os.File
+	dec  *Decoder
+	done chan struct{}
+	once sync.Once
+}
+
+// Follow opens the file name for following.
+func Follow(name string) (*Follower, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	fl := &Follower{Poll: 250 * time.Millisecond, name: name, f: f, done: make(chan struct{})}
+	fl.dec = NewDecoder(followSource{fl})
+	return fl, nil
+}
+
+// Decoder returns the Decoder the records are read with, so that its settings
+// can be changed before the first read. Read it with the methods of Follower.
+func (fl *Follower) Decoder() *Decoder {
+	return fl.dec
+}
+
+// followSource 是Decoder读取的数据源，读到文件尾时等待新的数据
+type followSource struct {
+	fl *Follower
+}
+
+func (s followSource) Read(p []byte) (int, error) {
+	fl := s.fl
+	for {
+		fl.mu.Lock()
+		if fl.f == nil {
+			fl.mu.Unlock()
+			return 0, ErrFollowerClosed
+		}
+		n, err := fl.f.Read(p)
+		if err == io.EOF {
+			err = fl.check()
+		}
+		fl.mu.Unlock()
+		if n > 0 || (err != nil && err != io.EOF) {
+			return n, err
+		}
+		select {
+		case <-fl.done:
+		case <-time.After(fl.Poll):
+		}
+	}
+}
+
+// check 在文件尾检查文件是否被截断或者轮换，是则打开新的内容并返回errRestart
+func (fl *Follower) check() error {
+	offset, err := fl.f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	cur, err := fl.f.Stat()
+	if err != nil {
+		return err
+	}
+	if cur.Size() < offset {
+		//截断后从头读取
+		if _, err := fl.f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		return errRestart
+	}
+	next, err := os.Stat(fl.name)
+	if err != nil || os.SameFile(cur, next) {
+		//轮换时新文件可能还没有创建
+		return io.EOF
+	}
+	f, err := os.Open(fl.name)
+	if err != nil {
+		return io.EOF
+	}
+	fl.f.Close()
+	fl.f = f
+	return errRestart
+}
+
+// restart 丢弃已经读取的内容和注册的类型，保留设置
+func (fl *Follower) restart() {
+	fl.dec.reader.reset()
+	fl.dec.types = map[ttType][]string{}
+	fl.dec.currentType = nil
+	fl.dec.err = nil
+	fl.dec.replay = nil
+}
+
+// Read reads the next record of an untyped file, see Reader.Read.
+func (fl *Follower) Read() ([]string, error) {
+	for {
+		record, err := fl.dec.reader.Read()
+		if !errors.Is(err, errRestart) {
+			return record, err
+		}
+		fl.restart()
+	}
+}
+
+// Decode reads the next record of a typed file into v, see Decoder.Decode.
+func (fl *Follower) Decode(v interface{}) error {
+	for {
+		err := fl.dec.Decode(v)
+		if !errors.Is(err, errRestart) {
+			return err
+		}
+		fl.restart()
+	}
+}
+
+// DecodeRow reads the next record of a typed file, see Decoder.DecodeRow.
+func (fl *Follower) DecodeRow() (*Row, error) {
+	for {
+		row, err := fl.dec.DecodeRow()
+		if !errors.Is(err, errRestart) {
+			return row, err
+		}
+		fl.restart()
+	}
+}
+
+// Close stops following and closes the file. A read blocked in another
+// goroutine returns ErrFollowerClosed.
+func (fl *Follower) Close() error {
+	var err error
+	fl.once.Do(func() {
+		close(fl.done)
+		fl.mu.Lock()
+		err = fl.f.Close()
+		fl.f = nil
+		fl.mu.Unlock()
+	})
+	return err
+}
@@ -46,8 +46,14 @@ import (
 	"fmt"
 	"io"
 	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
 )
 
+// A ParseError is returned for parsing errors.
+// Line and column numbers are 1-indexed.
 type ParseError struct {
 	Line   int   // Line where the error occurred
 	Column int   // Column (rune index) where the error occurred
@@ -58,6 +64,7 @@ var (
 	ErrQuote      = errors.New("extraneous ` in field")
 	ErrUpQuote    = errors.New("extraneous ^ in field")
 	ErrNotUpQuote = errors.New("extraneous ^ not end field")
+	ErrNotEnd     = errors.New("quoted-field not end")
 	ErrFieldCount = errors.New("wrong number of fields in line")
 )
 
@@ -65,12 +72,65 @@ func (e *ParseError) Error() string {
 	return fmt.Sprintf("line:%d,column:%d parse error:%s", e.Line, e.Column, e.Err)
 }
 
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// position 是读取的位置，行号和列号都从1开始
+type position struct {
+	line, column int
+}
+
+// posReader 在bufio.Reader的基础上记录已经读取的字节数和行列位置
+type posReader struct {
+	r        *bufio.Reader
+	offset   int64
+	line     int   //已经读完的行数
+	column   int   //当前行已经读取的字符数
+	limit    int64 //ReadString可以读到的位置，0表示没有限制
+	limitErr error //超过limit时返回的错误
+}
+
+func (p *posReader) pos() position {
+	return position{p.line + 1, p.column + 1}
+}
+
+func (p *posReader) advance(s string) {
+	p.offset += int64(len(s))
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		p.line += strings.Count(s, "\n")
+		p.column = utf8.RuneCountInString(s[i+1:])
+	} else {
+		p.column += utf8.RuneCountInString(s)
+	}
+}
+
+func (p *posReader) ReadRune() (r rune, size int, err error) {
+	if r, size, err = p.r.ReadRune(); err == nil {
+		p.offset += int64(size)
+		if r == '\n' {
+			p.line++
+			p.column = 0
+		} else {
+			p.column++
+		}
+	}
+	return
+}
+
+func (p *posReader) Peek(n int) ([]byte, error) {
+	return p.r.Peek(n)
+}
+
 // A Reader reads records from a TT-encoded file.
 //
 // As returned by NewReader. The exported fields can be changed to customize
 // the details before the first call to Read or ReadAll.
 //
-// Comma is the field delimiter. It defaults to '\t'.
+// Comma is the field delimiter. It defaults to '\t'. Delimiter, if not
+// empty, is a field delimiter of any length used instead of Comma, e.g.
+// "\x1f". Terminator, if not empty, is the record terminator, e.g. "\x1e";
+// by default records are terminated by \n, the \r of a \r\n being dropped.
 //
 // Comment, if not 0, is the comment character. Lines beginning with the Comment
 // character are ignored.
@@ -80,36 +140,119 @@ func (e *ParseError) Error() string {
 // fields in the first record, so that future records must have the same field
 // count. If FieldsPerRecord is negative, no check is made and records may have
 // a variable number of fields.
+//
+// Encoding is the character set of the input, e.g. unicode.UTF16 or
+// simplifiedchinese.GB18030 from golang.org/x/text. If it is nil, the
+// character set is detected from the byte order mark: UTF-8, UTF-16 (either
+// byte order) and GB18030 are recognized, and input without a byte order mark
+// is UTF-8. A leading byte order mark is never part of the first field.
+// Use Decoder.Reader to set the Encoding of a Decoder.
+//
+// InvalidUTF8 tells what to do with fields that are not valid UTF-8: keep
+// the bytes (the default), replace them with U+FFFD or fail with a
+// *ParseError. Transcoded input is always valid UTF-8; invalid input
+// sequences are replaced by the Encoding.
+//
+// If TrimPadding is true, the spaces that end an unquoted field and the
+// spaces after a closing quote are dropped, so that files aligned by a
+// Writer in Pretty mode read back unchanged.
+//
+// Dialect is the quoting syntax of the input, DialectTT by default. Use
+// DialectRFC4180 or DialectExcel to read text quoted with double quotes,
+// e.g. pasted from a spreadsheet.
+//
+// MaxFieldBytes, MaxRecordBytes and MaxFieldsPerRecord, if positive, limit the
+// bytes of the content of a field, the bytes of a record or comment line
+// (without its terminator) and the number of fields of a record. Quoted
+// fields are never read beyond the limits. Exceeding a limit returns a
+// *ParseError wrapping ErrFieldTooLong, ErrRecordTooLong or
+// ErrTooManyFields at the start of the offending field, and the rest of the
+// line is skipped.
 type Reader struct {
-	Comma           rune // field delimiter (set to '\t' by NewReader)
-	Comment         rune // comment character for start of line
-	FieldsPerRecord int  // number of expected fields per record
-	r               *bufio.Reader
+	Comma              rune              // field delimiter (set to '\t' by NewReader)
+	Comment            rune              // comment character for start of line
+	FieldsPerRecord    int               // number of expected fields per record
+	Encoding           encoding.Encoding // character set of the input, nil to detect
+	InvalidUTF8        UTF8Mode          // handling of invalid UTF-8
+	TrimPadding        bool              // drop the padding of aligned files
+	Dialect            Dialect           // quoting syntax
+	Delimiter          string            // field delimiter, Comma if empty
+	Terminator         string            // record terminator, newline if empty
+	MaxFieldBytes      int               // maximum bytes of a field, 0 for no limit
+	MaxRecordBytes     int               // maximum bytes of a record, 0 for no limit
+	MaxFieldsPerRecord int               // maximum fields of a record, 0 for no limit
+	src                io.Reader
+	r                  *posReader
+	fieldPos           []position
+	recordStart        int64
+	pending            chan readResult //ReadContext放弃的读取
+	ready              *readResult     //已经完成但还没有返回的放弃的读取
+	pendingPos         position        //放弃的读取开始的位置
+	transcoded         bool            //输入经过了字符集转换
 }
 
 //NewReader returns a new Reader that reads from r.
 func NewReader(r io.Reader) *Reader {
 	return &Reader{
 		Comma: '\t',
-		r:     bufio.NewReader(r),
+		src:   r,
+	}
+}
+
+// init 在第一次读取时按照设置的字符集创建读取器，并去掉字节顺序标记
+func (r *Reader) init() {
+	if r.r != nil {
+		return
 	}
+	src, transcoded := decodingReader(r.src, r.Encoding)
+	r.r = &posReader{r: bufio.NewReader(src)}
+	r.transcoded = transcoded
+	if c, size, err := r.r.r.ReadRune(); err == nil {
+		if c == '\uFEFF' {
+			r.r.offset += int64(size)
+		} else {
+			r.r.r.UnreadRune()
+		}
+	}
+}
+
+// reset 丢弃已经读取的内容，下一次读取时重新从src开始
+func (r *Reader) reset() {
+	r.r = nil
+	r.fieldPos = nil
+	r.recordStart = 0
+	r.pending = nil
+	r.ready = nil
 }
 
 //Read reads one record from r. The record is a slice of strings with each
 // string representing one field.
+//
+// If the record has an unexpected number of fields, Read returns the record
+// along with a *ParseError wrapping ErrFieldCount.
 func (r *Reader) Read() (record []string, err error) {
+	return r.readRecord(r.ReadWithFormat)
+}
+
+// readRecord 用read读取下一个记录，跳过空行和注释，并检查字段个数
+func (r *Reader) readRecord(read func() ([]string, []string, error)) (record []string, err error) {
 	for {
-		record, _, err = r.ReadWithFormat()
+		record, _, err = read()
+		//最后一行没有换行符时，数据和EOF一起返回
+		if err != nil && (err != io.EOF || record == nil) {
+			return nil, err
+		}
 		if record != nil {
 			break
 		}
-		if err != nil {
-			return nil, err
-		}
 	}
 	if r.FieldsPerRecord > 0 {
 		if len(record) != r.FieldsPerRecord {
-			return record, fmt.Errorf("error field count:%d,must is :%d,data:%#v", len(record), r.FieldsPerRecord, record)
+			return record, &ParseError{
+				Line:   r.fieldPos[0].line,
+				Column: r.fieldPos[0].column,
+				Err:    fmt.Errorf("%w, has %d fields, must be %d", ErrFieldCount, len(record), r.FieldsPerRecord),
+			}
 		}
 	} else if r.FieldsPerRecord == 0 {
 		r.FieldsPerRecord = len(record)
@@ -117,6 +260,35 @@ func (r *Reader) Read() (record []string, err error) {
 	return record, nil
 }
 
+// FieldPos returns the line and column corresponding to the start of the field
+// with the given index in the record most recently returned by Read or
+// ReadWithFormat. Numbering of lines and columns starts at 1; columns are
+// counted in runes.
+//
+// If this is called with an out-of-bounds index, it panics. If a read
+// abandoned by ReadContext is still going on, FieldPos waits for it and
+// reports the fields of the record it read, which the next read returns.
+func (r *Reader) FieldPos(field int) (line, column int) {
+	r.settle()
+	if field < 0 || field >= len(r.fieldPos) {
+		panic("out of range index passed to FieldPos")
+	}
+	p := r.fieldPos[field]
+	return p.line, p.column
+}
+
+// InputOffset returns the input stream byte offset of the current reader
+// position. The offset gives the location of the end of the most recently
+// read record and the beginning of the next one. Like FieldPos, it waits for
+// a read abandoned by ReadContext.
+func (r *Reader) InputOffset() int64 {
+	r.settle()
+	if r.r == nil {
+		return 0
+	}
+	return r.r.offset
+}
+
 // ReadAll reads all the remaining records from r.
 // Each record is a slice of fields.
 // A successful call returns err == nil, not err == EOF. Because ReadAll is
@@ -135,92 +307,240 @@ func (r *Reader) ReadAll() (records [][]string, err error) {
 	}
 }
 
-//当是空行,返回nil,当是注释，返回nil,[]string{注释内容}
+// parseError 返回指定位置的解析错误，并跳过该行剩余的内容，使下次读取从下一行开始
+func (dec *Reader) parseError(pos position, err error) error {
+	if err != ErrNotEnd {
+		if dec.Terminator != "" {
+			dec.r.skip(dec.Terminator)
+		} else {
+			dec.r.skip("\n")
+		}
+	}
+	return &ParseError{Line: pos.line, Column: pos.column, Err: err}
+}
+
+// unquoted 返回未引用字段的内容，需要时去掉填充的空格
+func (dec *Reader) unquoted(field *bytes.Buffer) string {
+	if dec.TrimPadding {
+		return strings.TrimRight(field.String(), " ")
+	}
+	return field.String()
+}
+
+// endQuoted 读取引用字段结束后的字符，只能是分隔符或者行尾，
+// 返回true表示记录已经结束
+func (dec *Reader) endQuoted(extraneous error) (bool, error) {
+	pos := dec.r.pos()
+	r, _, err := dec.r.ReadRune()
+	//跳过填充的空格
+	for err == nil && r == ' ' && dec.TrimPadding {
+		pos = dec.r.pos()
+		r, _, err = dec.r.ReadRune()
+	}
+	if err != nil {
+		return true, err
+	}
+	switch {
+	case dec.match(r, dec.delimiter()):
+		return false, nil
+	case dec.Terminator != "":
+		if dec.match(r, dec.Terminator) {
+			return true, nil
+		}
+	case r == '\n':
+		return true, nil
+	case r == '\r':
+		if next, err := dec.r.Peek(1); err == nil && next[0] == '\n' {
+			dec.r.ReadRune()
+			return true, nil
+		} else if err == io.EOF {
+			return true, err
+		}
+	}
+	return true, dec.parseError(pos, extraneous)
+}
+
+//ReadWithFormat reads one record from r along with the quoting of each field:
+// "" for a plain field, "`" for a quoted-field and "^id^" for a field quoted
+// with the ^id^ delimiter, or `"` for a quoted-field of the RFC4180 and the
+// Excel Dialect.
+// 当是空行,返回nil,当是注释，返回nil,[]string{注释内容}
+// Syntax errors are returned as *ParseError and the rest of the line is
+// skipped, so the next call starts with the following line.
 func (dec *Reader) ReadWithFormat() ([]string, []string, error) {
+	//先返回被放弃的ReadContext读取到的结果
+	dec.settle()
+	if res := dec.ready; res != nil {
+		dec.ready = nil
+		return res.values, res.formats, res.err
+	}
+	return dec.readWithFormat()
+}
+
+func (dec *Reader) readWithFormat() ([]string, []string, error) {
+	dec.init()
 	result := []string{}
 	format := []string{}
 	oneField := &bytes.Buffer{}
+	dec.fieldPos = dec.fieldPos[:0]
+	dec.recordStart = dec.r.offset
+	fieldStart := true
 	for {
-		if r, _, err := dec.r.ReadRune(); err != nil {
+		if !fieldStart {
+			if err := dec.checkLimits(oneField.Len()); err != nil {
+				return result, format, err
+			}
+		}
+		pos := dec.r.pos()
+		r, size, err := dec.r.ReadRune()
+		if err != nil {
 			if err == io.EOF {
 				//如果首字符是EOF，则返回nil
 				if len(result) == 0 && oneField.Len() == 0 {
 					result = nil
 					format = nil
 				} else {
-					result = append(result, oneField.String())
+					if fieldStart {
+						if err := dec.startField(pos); err != nil {
+							return result, format, err
+						}
+					}
+					result = append(result, dec.unquoted(oneField))
 					format = append(format, "")
 				}
 			}
 			return result, format, err
-		} else {
-			switch r {
-			case dec.Comment:
-				//如果首字符是注释符号，则返回nil
-				if len(result) == 0 && oneField.Len() == 0 {
-					comment, err := dec.r.ReadString('\n')
-					return nil, []string{comment}, err
-				}
-			case dec.Comma:
-				result = append(result, oneField.String())
-				format = append(format, "")
-				oneField.Reset()
-			case '\r':
-				//\r被丢弃
-				if nextC, err := dec.r.Peek(1); err != nil {
-					return nil, nil, err
-				} else if nextC[0] != '\n' {
-					if _, err := oneField.WriteRune(r); err != nil {
-						return nil, nil, err
-					}
-				}
-			case '\n':
-				//如果首字符是\n，则返回nil
-				if len(result) == 0 && oneField.Len() == 0 {
-					result = nil
-					format = nil
-				} else {
-					result = append(result, oneField.String())
-					format = append(format, "")
-				}
-				return result, format, nil
-			case '`':
-				if oneField.Len() != 0 {
-					return result, format, fmt.Errorf("the line :%v,%s format error,\"`\"at the data", result, oneField)
-				}
-				if str, err := dec.r.ReadString('`'); err != nil {
-					return result, format, fmt.Errorf("the line :%v,%s format error,\"`\" not end", result, str)
-				} else {
-					//取出最后的`符号
-					result = append(result, str[:len(str)-1])
-					format = append(format, "`")
-				}
-				if r1, _, err := dec.r.ReadRune(); err != nil || r1 != dec.Comma {
-					return result, format, err
-				}
-			case '^':
-				if oneField.Len() != 0 {
-					return result, format, fmt.Errorf("the line :%v,%s format error,\"^\"at the data", result, oneField)
-				}
-				if str, err := dec.r.ReadString('^'); err != nil {
-					return result, format, fmt.Errorf("the line :%v,%s format error,\"^\" not end", result, str)
-				} else {
-					id := "^" + str
-					if oneField, err := read(dec.r, []byte(id)); err != nil {
-						return result, format, fmt.Errorf("the line :%v,%s format error,%s not end", result, oneField, id)
-					} else {
-						result = append(result, string(oneField))
-						format = append(format, id)
-					}
-				}
-				if r1, _, err := dec.r.ReadRune(); err != nil || r1 != dec.Comma {
-					return result, format, err
+		}
+		if fieldStart {
+			if err := dec.startField(pos); err != nil {
+				return result, format, err
+			}
+			fieldStart = false
+		}
+		switch {
+		case r == dec.Comment && dec.Comment != 0 && len(result) == 0 && oneField.Len() == 0:
+			//如果首字符是注释符号，则返回nil
+			if dec.Terminator == "" {
+				dec.setLimit(1, false)
+				comment, err := dec.r.ReadString('\n')
+				if err == ErrRecordTooLong {
+					return nil, nil, dec.parseError(pos, err)
 				}
-			default:
+				return nil, []string{comment}, err
+			}
+			dec.setLimit(len(dec.Terminator), false)
+			comment, err := read(dec.r, []byte(dec.Terminator))
+			if err == ErrRecordTooLong {
+				return nil, nil, dec.parseError(pos, err)
+			}
+			if err == nil {
+				comment = append(comment, dec.Terminator...)
+			}
+			return nil, []string{string(comment)}, err
+		case dec.match(r, dec.delimiter()):
+			result = append(result, dec.unquoted(oneField))
+			format = append(format, "")
+			oneField.Reset()
+			fieldStart = true
+		case dec.Terminator != "" && dec.match(r, dec.Terminator):
+			//如果首字符是结束符，则返回nil
+			if len(result) == 0 && oneField.Len() == 0 {
+				return nil, nil, nil
+			}
+			result = append(result, dec.unquoted(oneField))
+			format = append(format, "")
+			return result, format, nil
+		case r == '\r' && dec.Terminator == "":
+			//\r被丢弃
+			if nextC, err := dec.r.Peek(1); err == nil && nextC[0] != '\n' {
 				if _, err := oneField.WriteRune(r); err != nil {
 					return nil, nil, err
 				}
 			}
+		case r == '\n' && dec.Terminator == "":
+			//如果首字符是\n，则返回nil
+			if len(result) == 0 && oneField.Len() == 0 {
+				result = nil
+				format = nil
+			} else {
+				result = append(result, dec.unquoted(oneField))
+				format = append(format, "")
+			}
+			return result, format, nil
+		case r == '"' && dec.Dialect != DialectTT:
+			if oneField.Len() != 0 {
+				if dec.Dialect == DialectExcel {
+					oneField.WriteRune(r)
+					continue
+				}
+				return result, format, dec.parseError(pos, ErrBareQuote)
+			}
+			str, err := dec.readDoubleQuoted(pos)
+			if err != nil {
+				return result, format, err
+			}
+			result = append(result, str)
+			format = append(format, `"`)
+			if end, err := dec.endQuoted(ErrDoubleQuote); end || err != nil {
+				return result, format, err
+			}
+			fieldStart = true
+		case r == '`' && dec.Dialect == DialectTT:
+			if oneField.Len() != 0 {
+				return result, format, dec.parseError(pos, ErrQuote)
+			}
+			dec.setLimit(1, true)
+			str, err := dec.r.ReadString('`')
+			if err != nil {
+				return result, format, dec.quotedError(pos, err)
+			}
+			//取出最后的`符号
+			if str, err = dec.checkUTF8(str[:len(str)-1], pos.advance("`")); err != nil {
+				return result, format, err
+			}
+			result = append(result, str)
+			format = append(format, "`")
+			if end, err := dec.endQuoted(ErrQuote); end || err != nil {
+				return result, format, err
+			}
+			fieldStart = true
+		case r == '^' && dec.Dialect == DialectTT:
+			if oneField.Len() != 0 {
+				return result, format, dec.parseError(pos, ErrUpQuote)
+			}
+			dec.setLimit(1, true)
+			str, err := dec.r.ReadString('^')
+			if err != nil {
+				return result, format, dec.quotedError(pos, err)
+			}
+			id := "^" + str
+			dec.setLimit(len(id), true)
+			field, err := read(dec.r, []byte(id))
+			if err != nil {
+				return result, format, dec.quotedError(pos, err)
+			}
+			str, err = dec.checkUTF8(string(field), pos.advance(id))
+			if err != nil {
+				return result, format, err
+			}
+			result = append(result, str)
+			format = append(format, id)
+			if end, err := dec.endQuoted(ErrNotUpQuote); end || err != nil {
+				return result, format, err
+			}
+			fieldStart = true
+		case r == utf8.RuneError && size == 1 && dec.InvalidUTF8 != UTF8Replace:
+			//无效的UTF-8字节
+			if dec.InvalidUTF8 == UTF8Error {
+				return result, format, dec.parseError(pos, ErrInvalidUTF8)
+			}
+			dec.r.r.UnreadRune()
+			b, _ := dec.r.r.ReadByte()
+			oneField.WriteByte(b)
+		default:
+			if _, err := oneField.WriteRune(r); err != nil {
+				return nil, nil, err
+			}
 		}
 	}
 }
@@ -249,60 +569,100 @@ func read(r reader, delim []byte) (line []byte, err error) {
 // newline and uses '\t' as the field delimiter.  The exported fields can be
 // changed to customize the details before the first call to Write or WriteAll.
 //
-// Comma is the field delimiter.
+// Comma is the field delimiter. Delimiter, if not empty, is a field delimiter
+// of any length used instead of Comma. Terminator, if not empty, is the
+// record terminator, \n by default. Fields containing the delimiter or the
+// terminator are quoted; with a Terminator set, \r and \n are ordinary
+// characters.
+//
+// Comment, if not 0, is the comment character used by WriteComment. Fields
+// beginning with it are quoted so that they are not read back as comments.
+//
+// Encoding, if not nil, is the character set the output is transcoded to,
+// e.g. unicode.UTF16 or simplifiedchinese.GB18030 from golang.org/x/text.
+// If BOM is true, a byte order mark in that character set is written before
+// the first record. Use Encoder.Writer to set them for an Encoder.
+//
+// InvalidUTF8 tells what to do with fields that are not valid UTF-8: write
+// the bytes as they are (the default), replace them with U+FFFD or fail with
+// an error wrapping ErrInvalidUTF8.
+//
+// Quote is the QuotePolicy Write uses to choose the quoting of each field.
+// Whatever the policy, a first field * or @ is not quoted when it can be
+// written plain, so that typed files don't take it for a type line.
+// LongFieldLength is the length QuoteReadable uses, DefaultLongFieldLength
+// if 0.
+//
+// If Pretty is true, the records are held until Flush, and then every run of
+// consecutive records with the same number of fields is aligned: fields but
+// the last are padded with spaces to the width of their column, counting
+// East Asian wide characters as two columns. Multi-line fields are not
+// aligned. Fields ending with a space are quoted, so that a Reader with
+// TrimPadding reads the file back unchanged. An Encoder on a pretty Writer
+// does not flush after each record; call Flush on its Writer when done.
+//
+// Dialect is the quoting syntax of the output, DialectTT by default. With the
+// RFC4180 and the Excel Dialect every quoted field is written with double
+// quotes, whatever its format, and QuoteBacktick quotes every field with
+// double quotes.
 type Writer struct {
-	Comma rune
-	w     *bufio.Writer
+	Comma           rune
+	Comment         rune
+	Encoding        encoding.Encoding
+	BOM             bool
+	InvalidUTF8     UTF8Mode
+	Quote           QuotePolicy
+	LongFieldLength int
+	Pretty          bool
+	Dialect         Dialect
+	Delimiter       string
+	Terminator      string
+	dst             io.Writer
+	w               *bufio.Writer
+	pretty          []prettyLine
 }
 
 // NewWriter returns a new Writer that writes to w.
 func NewWriter(w io.Writer) *Writer {
 	return &Writer{
-		w:     bufio.NewWriter(w),
+		dst:   w,
 		Comma: '\t',
 	}
 }
+
+// init 在第一次写入时按照设置的字符集创建写入器，并写入字节顺序标记
+func (w *Writer) init() {
+	if w.w != nil {
+		return
+	}
+	w.w = bufio.NewWriter(encodingWriter(w.dst, w.Encoding))
+	if w.BOM {
+		w.w.WriteRune('\uFEFF')
+	}
+}
 func (w *Writer) getEncodeFormat(str string) string {
 	notSign := true
 	notSpec := true
-	dolaId := []string{}
-	oneId := bytes.Buffer{}
-	idLen := -1
 	if str == "" {
 		return ""
 	}
-	//如果是` ^开头，则取消非特殊化标识，因为解析时会错误识别为多行字符串
-	if str[0] == '^' {
+	//如果是注释符号开头，则取消非特殊化标识，因为解析时会识别为注释
+	if w.Comment != 0 && strings.HasPrefix(str, string(w.Comment)) {
 		notSpec = false
 	}
 	for _, c := range str {
-		if idLen > -1 {
-			idLen++
-			//只捕获前9位，如果没有^出现，则复位
-			if idLen > 9 {
-				idLen = -1
-			}
-		}
 		switch c {
 		case '`':
 			notSign = false
-		case '\r', '\n', w.Comma:
 			notSpec = false
 		case '^':
-			//如果捕获ID已经开始，则增加ID
-			if idLen > -1 {
-				dolaId = append(dolaId, oneId.String())
-			}
-			//开始捕获ID
-			oneId.Truncate(0)
-			idLen = 0
-
-		default:
-			if idLen > -1 {
-				oneId.WriteRune(c)
-			}
+			//` ^出现在字段中，解析时会错误识别为多行字符串
+			notSpec = false
 		}
 	}
+	if w.hasSeparator(str) {
+		notSpec = false
+	}
 	//如果没有含有歧义的字符，则是原样输出
 	if notSpec {
 		return ""
@@ -311,37 +671,65 @@ func (w *Writer) getEncodeFormat(str string) string {
 	if notSign {
 		return "`"
 	}
-	//确定一个分割字符串
-	dem := ""
-	has := false
-	for _, oneId := range dolaId {
-		if oneId == dem {
-			has = true
-			break
+	return heredocID(str)
+}
+
+// heredocID 确定一个分割字符串^id^，字段内容后加上分割字符串时，
+// 分割字符串第一次出现的位置必须在末尾，否则解析时会提前结束
+func heredocID(str string) string {
+	for i := 0; ; i++ {
+		id := "^^"
+		if i > 0 {
+			id = "^" + strconv.Itoa(i) + "^"
+		}
+		if strings.Index(str+id, id) == len(str) {
+			return id
 		}
 	}
-	if has {
-		for i := 1; i < 1000; i++ {
-			dem = strconv.Itoa(i)
-			has = false
-			for _, oneId := range dolaId {
-				if oneId == dem {
-					has = true
-					break
-				}
+}
+
+// FieldFormat returns the quoting Write uses for field, in the form returned
+// by Reader.ReadWithFormat.
+func (w *Writer) FieldFormat(field string) string {
+	return w.quoteFormat(field)
+}
+
+func (w *Writer) WriteWithFormat(record []string, format []string) (err error) {
+	w.init()
+	if w.Pretty || w.InvalidUTF8 == UTF8Replace {
+		record = append([]string(nil), record...)
+	}
+	for i, v := range record {
+		if w.InvalidUTF8 != UTF8Preserve && !utf8.ValidString(v) {
+			if w.InvalidUTF8 == UTF8Error {
+				return fmt.Errorf("field %d: %w", i, ErrInvalidUTF8)
 			}
-			if !has {
-				break
+			record[i] = replaceUTF8(v)
+		}
+	}
+	if w.Dialect != DialectTT {
+		//其他方言只有"一种引用方式
+		dfmt := make([]string, len(format))
+		for i, f := range format {
+			if f != "" {
+				dfmt[i] = `"`
 			}
 		}
+		format = dfmt
 	}
-	if has {
-		panic("can't gen the ^??^ id")
-	} else {
-		return "^" + dem + "^"
+	if w.Pretty {
+		format = append([]string(nil), format...)
+		for i, v := range record {
+			format[i] = w.padFormat(v, format[i])
+		}
+		w.pretty = append(w.pretty, prettyLine{record: record, format: format})
+		return nil
 	}
+	return w.writeRecord(record, format, nil)
 }
-func (w *Writer) WriteWithFormat(record []string, format []string) (err error) {
+
+// writeRecord 写入一行记录，widths不为nil时把字段填充到对应的宽度
+func (w *Writer) writeRecord(record []string, format []string, widths []int) (err error) {
 	for i, v := range record {
 		if format[i] == "" {
 			if _, err = w.w.WriteString(v); err != nil {
@@ -358,6 +746,10 @@ func (w *Writer) WriteWithFormat(record []string, format []string) (err error) {
 			if _, err = w.w.WriteString(format[i]); err != nil {
 				return
 			}
+		} else if format[i] == `"` && w.Dialect != DialectTT {
+			if _, err = w.w.WriteString(`"` + strings.ReplaceAll(v, `"`, `""`) + `"`); err != nil {
+				return
+			}
 		} else if format[i][0] == '^' {
 			if _, err = w.w.WriteString(format[i]); err != nil {
 				return
@@ -373,13 +765,18 @@ func (w *Writer) WriteWithFormat(record []string, format []string) (err error) {
 		}
 		//last field
 		if i < len(record)-1 {
-			if _, err = w.w.WriteRune(w.Comma); err != nil {
+			if fw := fieldWidth(v, format[i]); widths != nil && fw >= 0 && fw < widths[i] {
+				if _, err = w.w.WriteString(strings.Repeat(" ", widths[i]-fw)); err != nil {
+					return
+				}
+			}
+			if _, err = w.w.WriteString(w.delimiter()); err != nil {
 				return
 			}
 
 		}
 	}
-	if _, err = w.w.WriteRune('\n'); err != nil {
+	if _, err = w.w.WriteString(w.newline()); err != nil {
 		return err
 	}
 	return
@@ -389,27 +786,73 @@ func (w *Writer) WriteWithFormat(record []string, format []string) (err error) {
 // A record is a slice of strings with each string being one field.
 func (w *Writer) Write(record []string) (err error) {
 
-	if w.w == nil {
+	if w.dst == nil {
 		return fmt.Errorf("must call NewWriter init the class")
 	}
 	if record == nil || len(record) == 0 {
 		return fmt.Errorf("the record is nil")
 	}
+	return w.WriteWithFormat(record, w.formats(record))
+}
+
+// formats 返回Write写入record时使用的引用方式
+func (w *Writer) formats(record []string) []string {
 	format := make([]string, len(record))
 	for i, v := range record {
-		format[i] = w.getEncodeFormat(v)
+		format[i] = w.quoteFormat(v)
+	}
+	//只有一个空字段的记录，需要引用，否则会被当作空行
+	if len(record) == 1 && record[0] == "" {
+		format[0] = "`"
+	}
+	//引用的*和@开始的记录会被Decoder当作类型行
+	if (record[0] == "*" || record[0] == "@") && !w.mustQuote(record[0]) {
+		format[0] = ""
+	}
+	return format
+}
+
+// WriteComment writes text as a comment line starting with the Comment
+// character. text must not contain a newline.
+func (w *Writer) WriteComment(text string) error {
+	if w.Comment == 0 {
+		return fmt.Errorf("the Comment character is not set")
 	}
-	return w.WriteWithFormat(record, format)
+	if strings.ContainsAny(text, "\r\n") {
+		return fmt.Errorf("the comment %q contains newline", text)
+	}
+	w.init()
+	if w.Pretty {
+		w.pretty = append(w.pretty, prettyLine{record: []string{text}, comment: true})
+		return nil
+	}
+	return w.writeComment(text)
+}
+
+func (w *Writer) writeComment(text string) error {
+	if _, err := w.w.WriteRune(w.Comment); err != nil {
+		return err
+	}
+	if _, err := w.w.WriteString(text); err != nil {
+		return err
+	}
+	_, err := w.w.WriteString(w.newline())
+	return err
 }
 
 // Flush writes any buffered data to the underlying io.Writer.
 // To check if an error occurred during the Flush, call Error.
 func (w *Writer) Flush() error {
+	w.init()
+	if err := w.writePretty(); err != nil {
+		return err
+	}
 	return w.w.Flush()
 }
 
 // Error reports any error that has occurred during a previous Write or Flush.
 func (w *Writer) Error() error {
+	w.init()
 	_, err := w.w.Write(nil)
 	return err
 }
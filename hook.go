@@ -0,0 +1,46 @@
+package gott
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// BeforeEncoder is implemented by types that prepare themselves before they
+// are written, e.g. to normalize their values. Encoder.Encode calls
+// BeforeEncodeTT before the fields are encoded.
+type BeforeEncoder interface {
+	BeforeEncodeTT() error
+}
+
+// AfterDecoder is implemented by types that complete themselves after they
+// are read, e.g. to compute derived fields. Decoder.Decode calls AfterDecodeTT
+// after the fields are decoded, before the value is validated.
+type AfterDecoder interface {
+	AfterDecodeTT() error
+}
+
+// A FieldHook transforms the text of a field of the struct type t, for
+// transforms that apply to many types, such as trimming or redaction. The
+// hooks of an Encoder get the encoded text before it is written, those of a
+// Decoder get the text read before it is decoded, except for the unquoted
+// Absent markers, the counts of child records and the values of interface
+// fields.
+//
+// For Encode the order is BeforeEncodeTT, the encoding of the fields, then
+// the hooks in order. For Decode it is the hooks in order, the decoding of
+// the fields, AfterDecodeTT, then the validation. EncodeRow and DecodeRow
+// don't call any hook. The values of registered types stored in interface
+// fields, see RegisterName, are encoded and decoded without any hook and are
+// not validated, so that they read back as they were.
+type FieldHook func(t reflect.Type, field, value string) (string, error)
+
+// runHooks 依次调用hooks转换属性的文本
+func runHooks(hooks []FieldHook, t reflect.Type, field, value string) (string, error) {
+	for _, hook := range hooks {
+		var err error
+		if value, err = hook(t, field, value); err != nil {
+			return "", fmt.Errorf("field %s: %w", field, err)
+		}
+	}
+	return value, nil
+}
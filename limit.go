@@ -0,0 +1,103 @@
+package gott
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+)
+
+// Errors returned when the input exceeds the limits of a Reader or a Decoder,
+// wrapped in a *ParseError.
+var (
+	ErrFieldTooLong  = errors.New("field too long")
+	ErrRecordTooLong = errors.New("record too long")
+	ErrTooManyFields = errors.New("too many fields in record")
+	ErrTooManyTypes  = errors.New("too many types")
+)
+
+// setLimit 设置引用字段读取的上限，closing是结束引用符号的长度，
+// field为false时只限制记录的长度
+func (dec *Reader) setLimit(closing int, field bool) {
+	dec.r.limit, dec.r.limitErr = 0, nil
+	if field && dec.MaxFieldBytes > 0 {
+		dec.r.limit = dec.r.offset + int64(dec.MaxFieldBytes+closing)
+		dec.r.limitErr = ErrFieldTooLong
+	}
+	if dec.MaxRecordBytes > 0 {
+		if limit := dec.recordStart + int64(dec.MaxRecordBytes); dec.r.limit == 0 || limit < dec.r.limit {
+			dec.r.limit, dec.r.limitErr = limit, ErrRecordTooLong
+		}
+	}
+}
+
+// checkLimits 检查当前字段和记录是否超过了长度限制，field是未引用字段已经读取的字节数
+func (dec *Reader) checkLimits(field int) error {
+	switch {
+	case dec.MaxFieldBytes > 0 && field > dec.MaxFieldBytes:
+		return dec.parseError(dec.fieldPos[len(dec.fieldPos)-1], ErrFieldTooLong)
+	case dec.MaxRecordBytes > 0 && dec.r.offset-dec.recordStart > int64(dec.MaxRecordBytes):
+		return dec.parseError(dec.fieldPos[len(dec.fieldPos)-1], ErrRecordTooLong)
+	}
+	return nil
+}
+
+// startField 记录新字段的开始位置，并检查字段的个数和记录的长度，
+// 只有分隔符的记录也不会超过限制
+func (dec *Reader) startField(pos position) error {
+	dec.fieldPos = append(dec.fieldPos, pos)
+	if dec.MaxFieldsPerRecord > 0 && len(dec.fieldPos) > dec.MaxFieldsPerRecord {
+		return dec.parseError(pos, ErrTooManyFields)
+	}
+	if dec.MaxRecordBytes > 0 && dec.r.offset-dec.recordStart > int64(dec.MaxRecordBytes) {
+		return dec.parseError(pos, ErrRecordTooLong)
+	}
+	return nil
+}
+
+// quotedError 转换读取引用字段时的错误
+func (dec *Reader) quotedError(pos position, err error) error {
+	switch err {
+	case io.EOF:
+		return dec.parseError(pos, ErrNotEnd)
+	case ErrFieldTooLong, ErrRecordTooLong:
+		return dec.parseError(pos, err)
+	}
+	return err
+}
+
+// ReadString 读取到delim为止，超过了上限时返回limitErr，只缓存读取的字符串本身
+func (p *posReader) ReadString(delim byte) (string, error) {
+	var buf []byte
+	for {
+		chunk, err := p.r.ReadSlice(delim)
+		if p.limit > 0 && p.offset+int64(len(buf)+len(chunk)) > p.limit {
+			p.advance(string(buf))
+			p.advance(string(chunk))
+			return "", p.limitErr
+		}
+		buf = append(buf, chunk...)
+		if err != bufio.ErrBufferFull {
+			p.advance(string(buf))
+			return string(buf), err
+		}
+	}
+}
+
+// skip 跳过到结束符term为止的输入，不缓存跳过的内容
+func (p *posReader) skip(term string) error {
+	tail := ""
+	for {
+		chunk, err := p.r.ReadSlice(term[len(term)-1])
+		p.advance(string(chunk))
+		if tail += string(chunk); len(tail) > len(term) {
+			tail = tail[len(tail)-len(term):]
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil || strings.HasSuffix(tail, term) {
+			return err
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package gott
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Tokens written for the special float values. The Decoder also accepts the
+// other spellings of strconv.ParseFloat, such as "inf" and "nan".
+const (
+	NaN    = "NaN"
+	PosInf = "+Inf"
+	NegInf = "-Inf"
+)
+
+// parseFloatFormat 解析浮点数的格式，如 g、f、f2、e6，
+// 格式字符同strconv.FormatFloat，没有精度时为能精确还原的最短表示
+func parseFloatFormat(f string) (verb byte, prec int, err error) {
+	if f == "" {
+		return 'g', -1, nil
+	}
+	if verb = f[0]; strings.IndexByte("efg", verb) < 0 {
+		return 0, 0, fmt.Errorf("invalid float format :%s", f)
+	}
+	if len(f) == 1 {
+		return verb, -1, nil
+	}
+	if prec, err = strconv.Atoi(f[1:]); err != nil || prec < 0 {
+		return 0, 0, fmt.Errorf("invalid float format :%s", f)
+	}
+	return verb, prec, nil
+}
+
+func formatFloat(f float64, bitSize int, c codec) (string, error) {
+	switch {
+	case math.IsNaN(f):
+		return NaN, nil
+	case math.IsInf(f, 1):
+		return PosInf, nil
+	case math.IsInf(f, -1):
+		return NegInf, nil
+	}
+	verb, prec, err := parseFloatFormat(c.floatFormat)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatFloat(f, verb, prec, bitSize), nil
+}
+
+func formatBigFloat(f *big.Float, c codec) (string, error) {
+	if f.IsInf() {
+		if f.Signbit() {
+			return NegInf, nil
+		}
+		return PosInf, nil
+	}
+	verb, prec, err := parseFloatFormat(c.floatFormat)
+	if err != nil {
+		return "", err
+	}
+	return f.Text(verb, prec), nil
+}
+
+// formatRat 有精度的定点格式时按照精度输出，否则输出精确的值：
+// 分母只有因子2和5时为有限小数，其他的为a/b的分数形式
+func formatRat(r *big.Rat, c codec) (string, error) {
+	verb, prec, err := parseFloatFormat(c.floatFormat)
+	if err != nil {
+		return "", err
+	}
+	if verb == 'f' && prec >= 0 {
+		return r.FloatString(prec), nil
+	}
+	if r.IsInt() {
+		return r.Num().String(), nil
+	}
+	d := new(big.Int).Set(r.Denom())
+	two, five := big.NewInt(2), big.NewInt(5)
+	m := new(big.Int)
+	digits := 0
+	for n2, n5 := 0, 0; ; {
+		if m.Mod(d, two).Sign() == 0 {
+			d.Quo(d, two)
+			n2++
+		} else if m.Mod(d, five).Sign() == 0 {
+			d.Quo(d, five)
+			n5++
+		} else {
+			if digits = n2; n5 > n2 {
+				digits = n5
+			}
+			break
+		}
+	}
+	if d.Cmp(big.NewInt(1)) == 0 {
+		return r.FloatString(digits), nil
+	}
+	return r.RatString(), nil
+}
+
+// parseBigFloat 解析为big.Float，原值有精度时沿用，否则按照数字的位数确定精度，
+// 保证十进制的值不会丢失
+func parseBigFloat(s string, old *big.Float) (*big.Float, error) {
+	var prec uint
+	if old != nil {
+		prec = old.Prec()
+	}
+	if prec == 0 {
+		//每个十进制数字约需要3.33位
+		if prec = uint(len(s)) * 4; prec < 64 {
+			prec = 64
+		}
+	}
+	f, _, err := big.ParseFloat(s, 10, prec, big.ToNearestEven)
+	return f, err
+}
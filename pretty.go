@@ -0,0 +1,117 @@
+package gott
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/width"
+)
+
+// prettyLine 是美化输出模式下缓存的一行，comment为true时是注释行
+type prettyLine struct {
+	record  []string
+	format  []string
+	comment bool
+}
+
+// runeWidth 返回字符显示的列数，东亚宽字符占两列
+func runeWidth(r rune) int {
+	switch {
+	case unicode.Is(unicode.Mn, r), unicode.Is(unicode.Me, r), unicode.Is(unicode.Cf, r):
+		return 0
+	}
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	}
+	return 1
+}
+
+// textWidth 返回字符串最后一行显示的列数
+func textWidth(s string) int {
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		s = s[i+1:]
+	}
+	n := 0
+	for _, r := range s {
+		n += runeWidth(r)
+	}
+	return n
+}
+
+// fieldWidth 返回字段加上引用符号后的显示列数，多行的字段不参与对齐，返回-1
+func fieldWidth(value, format string) int {
+	if strings.ContainsAny(value, "\r\n") {
+		return -1
+	}
+	if format == `"` {
+		//"引用时，其中的"要写两次
+		return textWidth(value) + strings.Count(value, `"`) + 2
+	}
+	return textWidth(value) + 2*len(format)
+}
+
+// padFormat 美化输出时，结尾有空格的字段必须引用，否则读取时会被当作填充去掉
+func (w *Writer) padFormat(value, format string) string {
+	if format != "" || !strings.HasSuffix(value, " ") {
+		return format
+	}
+	if w.Dialect != DialectTT {
+		return `"`
+	}
+	if strings.Contains(value, "`") {
+		return heredocID(value)
+	}
+	return "`"
+}
+
+// heldBytes 返回美化输出时缓存的行不加填充的字节数
+func (w *Writer) heldBytes() int64 {
+	var n int64
+	for _, l := range w.pretty {
+		for i, v := range l.record {
+			n += int64(len(v))
+			if i < len(l.format) {
+				n += int64(2 * len(l.format[i]))
+			}
+		}
+		n += int64(len(w.delimiter())*(len(l.record)-1) + len(w.newline()))
+	}
+	return n
+}
+
+// writePretty 写入缓存的行，连续的、字段数相同的记录按列对齐
+func (w *Writer) writePretty() error {
+	lines := w.pretty
+	w.pretty = nil
+	for start := 0; start < len(lines); {
+		if lines[start].comment {
+			if err := w.writeComment(lines[start].record[0]); err != nil {
+				return err
+			}
+			start++
+			continue
+		}
+		n := len(lines[start].record)
+		end := start + 1
+		for end < len(lines) && !lines[end].comment && len(lines[end].record) == n {
+			end++
+		}
+		//最后一个字段不需要填充
+		widths := make([]int, n-1)
+		for _, line := range lines[start:end] {
+			for i := range widths {
+				if fw := fieldWidth(line.record[i], line.format[i]); fw > widths[i] {
+					widths[i] = fw
+				}
+			}
+		}
+		for _, line := range lines[start:end] {
+			if err := w.writeRecord(line.record, line.format, widths); err != nil {
+				return err
+			}
+		}
+		start = end
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package gott
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// A QuotePolicy tells a Writer how to quote the fields passed to Write.
+// Whatever the policy, the output is read back unchanged by Reader. Only
+// QuoteMinimal and QuoteBacktick apply to the RFC4180 and the Excel Dialect.
+type QuotePolicy int
+
+const (
+	// QuoteMinimal quotes only the fields that need it, with backticks when
+	// the field has none and with a ^id^ heredoc otherwise (the default).
+	QuoteMinimal QuotePolicy = iota
+	// QuoteBacktick quotes every field, with backticks when the field has
+	// none and with a ^id^ heredoc otherwise.
+	QuoteBacktick
+	// QuoteHeredoc is QuoteMinimal, except that multi-line fields are always
+	// quoted with a ^id^ heredoc.
+	QuoteHeredoc
+	// QuoteReadable is QuoteHeredoc, except that fields longer than the
+	// LongFieldLength of the Writer are also quoted with a ^id^ heredoc.
+	QuoteReadable
+)
+
+// DefaultLongFieldLength is the number of characters from which
+// QuoteReadable quotes a field with a ^id^ heredoc when the LongFieldLength
+// of the Writer is 0.
+const DefaultLongFieldLength = 80
+
+// longFieldLength 返回QuoteReadable用heredoc引用的字段长度
+func (w *Writer) longFieldLength() int {
+	if w.LongFieldLength > 0 {
+		return w.LongFieldLength
+	}
+	return DefaultLongFieldLength
+}
+
+// mustQuote 返回str是否必须引用，即包含分隔符、结束符或以注释符号开始
+func (w *Writer) mustQuote(str string) bool {
+	return w.hasSeparator(str) || w.Comment != 0 && strings.HasPrefix(str, string(w.Comment))
+}
+
+// quoteFormat 按照引用策略调整最小引用格式
+func (w *Writer) quoteFormat(str string) string {
+	if w.Dialect != DialectTT {
+		return w.dialectFormat(str)
+	}
+	format := w.getEncodeFormat(str)
+	switch w.Quote {
+	case QuoteBacktick:
+		if format == "" {
+			format = "`"
+		}
+	case QuoteHeredoc, QuoteReadable:
+		if format == "`" && strings.ContainsAny(str, "\r\n") ||
+			w.Quote == QuoteReadable && utf8.RuneCountInString(str) > w.longFieldLength() {
+			format = heredocID(str)
+		}
+	}
+	return format
+}
@@ -0,0 +1,169 @@
+package gott
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// A RotatingEncoder writes records to a series of files, starting a new file
+// when the current one has MaxRecords records, MaxBytes bytes or is older than
+// Interval; a zero limit is not checked. The files are named by Pattern, a
+// format for fmt.Sprintf with one verb for the sequence number, e.g.
+// "events-%06d.tt". The sequence starts at 1, and existing files are never
+// overwritten: their numbers are skipped.
+//
+// MaxBytes counts the bytes written to the file. With a Pretty Writer the
+// records held for alignment count with their unpadded size, so a file may
+// exceed MaxBytes by the padding written when it is closed.
+//
+// Each file registers the types it uses with `*` lines, so that it can be
+// decoded on its own. A type keeps the same version number in all the files.
+//
+// Setup, if not nil, is called with the Encoder of each new file, to change its
+// settings. A RotatingEncoder must not be used by several goroutines at once.
+type RotatingEncoder struct {
+	Pattern    string
+	MaxRecords int
+	MaxBytes   int64
+	Interval   time.Duration
+	Setup      func(enc *Encoder)
+	seq        int
+	file       *os.File
+	out        *countWriter
+	enc        *Encoder
+	records    int
+	opened     time.Time
+	types      map[ttType][]string //之前的文件注册过的类型
+	now        func() time.Time
+}
+
+// NewRotatingEncoder returns a RotatingEncoder writing to the files named by
+// pattern, or an error if pattern doesn't have exactly one verb for the
+// sequence number.
+func NewRotatingEncoder(pattern string) (*RotatingEncoder, error) {
+	if err := checkPattern(pattern); err != nil {
+		return nil, err
+	}
+	return &RotatingEncoder{Pattern: pattern, types: map[ttType][]string{}, now: time.Now}, nil
+}
+
+// checkPattern 检查文件名格式中有且只有一个序号的动词
+func checkPattern(pattern string) error {
+	first, second := fmt.Sprintf(pattern, 1), fmt.Sprintf(pattern, 2)
+	if first == second || strings.Contains(first, "%!") {
+		return fmt.Errorf("the pattern %q must have one verb for the sequence number", pattern)
+	}
+	return nil
+}
+
+// countWriter 记录写入的字节数
+type countWriter struct {
+	f *os.File
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	n, err := w.f.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// Name returns the name of the current file, "" before the first record
+// and after Close.
+func (r *RotatingEncoder) Name() string {
+	if r.file == nil {
+		return ""
+	}
+	return r.file.Name()
+}
+
+// full 检查当前文件是否已经达到限制
+func (r *RotatingEncoder) full() bool {
+	return r.MaxRecords > 0 && r.records >= r.MaxRecords ||
+		r.MaxBytes > 0 && r.out.n+r.enc.writer.heldBytes() >= r.MaxBytes ||
+		r.Interval > 0 && r.now().Sub(r.opened) >= r.Interval
+}
+
+// open 在需要时关闭当前文件，创建下一个文件
+func (r *RotatingEncoder) open() error {
+	if r.file != nil {
+		if !r.full() {
+			return nil
+		}
+		if err := r.closeFile(); err != nil {
+			return err
+		}
+	}
+	//Pattern可能在创建后修改
+	if err := checkPattern(r.Pattern); err != nil {
+		return err
+	}
+	for {
+		r.seq++
+		f, err := os.OpenFile(fmt.Sprintf(r.Pattern, r.seq), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		r.file = f
+		break
+	}
+	r.out = &countWriter{f: r.file}
+	r.enc = NewEncoder(r.out)
+	r.enc.prevTypes = r.types
+	if r.Setup != nil {
+		r.Setup(r.enc)
+	}
+	r.records = 0
+	r.opened = r.now()
+	return nil
+}
+
+// closeFile 刷新并关闭当前文件，记录其中注册的类型
+func (r *RotatingEncoder) closeFile() error {
+	for ty, cols := range r.enc.types {
+		r.types[ty] = cols
+	}
+	err := r.enc.writer.Flush()
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	r.file, r.enc = nil, nil
+	return err
+}
+
+// Encode writes the struct v to the current file, see Encoder.Encode.
+func (r *RotatingEncoder) Encode(v interface{}) error {
+	if err := r.open(); err != nil {
+		return err
+	}
+	if err := r.enc.Encode(v); err != nil {
+		return err
+	}
+	r.records++
+	return nil
+}
+
+// EncodeRow writes row to the current file, see Encoder.EncodeRow.
+func (r *RotatingEncoder) EncodeRow(row *Row) error {
+	if err := r.open(); err != nil {
+		return err
+	}
+	if err := r.enc.EncodeRow(row); err != nil {
+		return err
+	}
+	r.records++
+	return nil
+}
+
+// Close flushes and closes the current file.
+func (r *RotatingEncoder) Close() error {
+	if r.file == nil {
+		return nil
+	}
+	return r.closeFile()
+}
@@ -0,0 +1,72 @@
+package gott
+
+import (
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// discard 读取并丢弃n个字节
+func (p *posReader) discard(n int) error {
+	buf := make([]byte, n)
+	n, err := io.ReadFull(p.r, buf)
+	p.advance(string(buf[:n]))
+	return err
+}
+
+// delimiter 返回字段分隔符，没有设置Delimiter时是Comma
+func (dec *Reader) delimiter() string {
+	if dec.Delimiter != "" {
+		return dec.Delimiter
+	}
+	return string(dec.Comma)
+}
+
+// match 检查刚读取的字符r和后面的输入是否是分隔符sep，是则读取整个分隔符
+func (dec *Reader) match(r rune, sep string) bool {
+	first, size := utf8.DecodeRuneInString(sep)
+	if sep == "" || r != first {
+		return false
+	}
+	rest := sep[size:]
+	if rest == "" {
+		return true
+	}
+	if next, err := dec.r.Peek(len(rest)); err != nil || string(next) != rest {
+		return false
+	}
+	return dec.r.discard(len(rest)) == nil
+}
+
+// delimiter 返回字段分隔符，没有设置Delimiter时是Comma
+func (w *Writer) delimiter() string {
+	if w.Delimiter != "" {
+		return w.Delimiter
+	}
+	return string(w.Comma)
+}
+
+// newline 返回记录的结束符
+func (w *Writer) newline() string {
+	switch {
+	case w.Terminator != "":
+		return w.Terminator
+	case w.Dialect == DialectExcel:
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// hasSeparator 检查字段是否需要引用，才能不被识别为分隔符或者结束符，
+// 字段结尾和后面的分隔符连起来也不能提前出现分隔符
+func (w *Writer) hasSeparator(str string) bool {
+	if w.Terminator == "" {
+		if strings.ContainsAny(str, "\r\n") {
+			return true
+		}
+	} else if strings.Index(str+w.Terminator, w.Terminator) < len(str) {
+		return true
+	}
+	sep := w.delimiter()
+	return strings.Index(str+sep, sep) < len(str)
+}
@@ -0,0 +1,181 @@
+package gott
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// DefaultImportBatchSize is the number of records ImportInto inserts with one
+// INSERT statement when its batchSize is not positive.
+const DefaultImportBatchSize = 100
+
+// ExportRows writes all the remaining rows to enc. The records are of the type
+// database/sql.Rows whose props are the column names reported by
+// rows.ColumnTypes. Columns the driver scans into []byte are written as
+// binary in the BytesFormat of enc, and their props carry the format like the
+// option of a tag, e.g. "data,bytes=base64", so that ImportInto and Decode
+// read them back as bytes. Other values are written as their text, times
+// formatted according to the TimeFormat and Location of enc. rows is not
+// closed.
+func ExportRows(enc *Encoder, rows *sql.Rows) error {
+	cts, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+	row := &Row{
+		PkgPath: "database/sql",
+		Name:    "Rows",
+		Columns: make([]string, len(cts)),
+		Values:  make([]string, len(cts)),
+	}
+	binary := make([]bool, len(cts))
+	bytesType := reflect.TypeOf([]byte(nil))
+	c := enc.codec()
+	format := c.bytesFormat
+	if format == "" {
+		format = BytesBase64
+	}
+	for i, ct := range cts {
+		row.Columns[i] = ct.Name()
+		if binary[i] = ct.ScanType() == bytesType; binary[i] {
+			row.Columns[i] += ",bytes=" + format
+		}
+	}
+	values := make([]interface{}, len(cts))
+	dest := make([]interface{}, len(cts))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		for i, v := range values {
+			//文本列的驱动值也可能是[]byte
+			if b, ok := v.([]byte); ok && !binary[i] {
+				v = string(b)
+			}
+			if row.Values[i], err = encode(v, c); err != nil {
+				return fmt.Errorf("column %s: %v", row.Columns[i], err)
+			}
+		}
+		if err := enc.EncodeRow(row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// isTableName 检查表名，可以带有模式名，如schema.table
+func isTableName(s string) bool {
+	for _, part := range strings.Split(s, ".") {
+		if !isIdentifier(part) {
+			return false
+		}
+	}
+	return true
+}
+
+// isIdentifier 检查列名，防止拼接到sql语句中
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		if !(c == '_' || unicode.IsLetter(c) || (i > 0 && unicode.IsDigit(c))) {
+			return false
+		}
+	}
+	return true
+}
+
+// ImportInto reads all the remaining records of dec and inserts them into
+// table within tx, batchSize records per INSERT statement, or
+// DefaultImportBatchSize if batchSize is not positive. The table, which may
+// be qualified by a schema, and the columns of each record, the props of its
+// type, must be plain identifiers. Props with a bytes option, as written by
+// ExportRows, are inserted as []byte. Empty fields are inserted as NULL. The
+// statements use ? placeholders. ImportInto returns the number of records
+// inserted.
+func ImportInto(dec *Decoder, tx *sql.Tx, table string, batchSize int) (int64, error) {
+	if !isTableName(table) {
+		return 0, fmt.Errorf("invalid table name %q", table)
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultImportBatchSize
+	}
+	var (
+		n       int64
+		header  []string
+		columns []string
+		codecs  []*codec //二进制列的设置
+		args    []interface{}
+		rows    int
+	)
+	flush := func() error {
+		if rows == 0 {
+			return nil
+		}
+		mark := "(" + strings.TrimSuffix(strings.Repeat("?,", len(columns)), ",") + ")"
+		query := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", table, strings.Join(columns, ","),
+			strings.TrimSuffix(strings.Repeat(mark+",", rows), ","))
+		if _, err := tx.Exec(query, args...); err != nil {
+			return err
+		}
+		n += int64(rows)
+		args, rows = args[:0], 0
+		return nil
+	}
+	for {
+		row, err := dec.DecodeRow()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return n, err
+		}
+		//类型变化时，先写入之前的记录
+		if !equalStrings(header, row.Columns) {
+			if err := flush(); err != nil {
+				return n, err
+			}
+			header = row.Columns
+			columns = make([]string, len(header))
+			codecs = make([]*codec, len(header))
+			for i, col := range header {
+				name, opts := parseTag(col)
+				if !isIdentifier(name) {
+					return n, fmt.Errorf("invalid column name %q", col)
+				}
+				columns[i] = name
+				if format, ok := opts.Get("bytes"); ok {
+					codecs[i] = &codec{bytesFormat: format}
+				}
+			}
+		}
+		for i, v := range row.Values {
+			switch {
+			case v == "":
+				args = append(args, nil)
+			case codecs[i] != nil:
+				b, err := decodeBytes(v, *codecs[i])
+				if err != nil {
+					return n, fmt.Errorf("column %s: %v", columns[i], err)
+				}
+				args = append(args, b)
+			default:
+				args = append(args, v)
+			}
+		}
+		if rows++; rows >= batchSize {
+			if err := flush(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, flush()
+}
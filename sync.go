@@ -0,0 +1,156 @@
+package gott
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// ErrEncoderClosed is returned by a SyncEncoder after Close.
+var ErrEncoderClosed = errors.New("encoder closed")
+
+// A SyncEncoder is an Encoder that may be used by many goroutines at once.
+// Each record is written at once along with the type lines it needs and its
+// child records, so the records of different goroutines never mix.
+//
+// A SyncEncoder returned by NewSyncEncoder writes each record before Encode
+// returns. One returned by NewQueuedEncoder only converts the value in
+// Encode, and a background goroutine writes the records queued, flushing
+// when the queue is empty; Encode blocks while the queue is full. An error of
+// the background writing is returned by the following calls and by Close.
+//
+// Change the settings of Encoder before the first call to Encode. Close must
+// be called when done.
+type SyncEncoder struct {
+	enc    *Encoder
+	mu     sync.RWMutex       //直接写入时互斥，后台写入时保护放入队列和关闭队列
+	queue  chan *structRecord //后台写入的队列，为nil时直接写入
+	done   chan struct{}      //后台写入结束
+	errMu  sync.Mutex
+	err    error //后台写入的错误
+	closed bool
+}
+
+// NewSyncEncoder returns a SyncEncoder writing to w before Encode returns.
+func NewSyncEncoder(w io.Writer) *SyncEncoder {
+	return &SyncEncoder{enc: NewEncoder(w)}
+}
+
+// NewQueuedEncoder returns a SyncEncoder writing to w in the background, with
+// a queue of size records.
+func NewQueuedEncoder(w io.Writer, size int) *SyncEncoder {
+	s := &SyncEncoder{
+		enc:   NewEncoder(w),
+		queue: make(chan *structRecord, size),
+		done:  make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Encoder returns the underlying Encoder, so that its settings can be
+// changed before the first call to Encode. It must not be used to write.
+func (s *SyncEncoder) Encoder() *Encoder {
+	return s.enc
+}
+
+// run 在后台写入队列中的记录，队列空时刷新缓存，出错后丢弃剩下的记录
+func (s *SyncEncoder) run() {
+	defer close(s.done)
+	w := s.enc.writer
+	for rec := range s.queue {
+		if s.error() != nil {
+			continue
+		}
+		err := s.enc.writeStruct(rec, nil, false)
+		if err == nil && len(s.queue) == 0 {
+			err = w.Flush()
+		}
+		if err != nil {
+			s.errMu.Lock()
+			s.err = err
+			s.errMu.Unlock()
+		}
+	}
+}
+
+func (s *SyncEncoder) error() error {
+	s.errMu.Lock()
+	defer s.errMu.Unlock()
+	return s.err
+}
+
+// put 把记录放入队列，队列满时等待
+func (s *SyncEncoder) put(rec *structRecord) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return ErrEncoderClosed
+	}
+	if err := s.error(); err != nil {
+		return err
+	}
+	s.queue <- rec
+	return nil
+}
+
+// Encode writes the struct v, see Encoder.Encode.
+func (s *SyncEncoder) Encode(v interface{}) error {
+	if s.queue == nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.closed {
+			return ErrEncoderClosed
+		}
+		return s.enc.Encode(v)
+	}
+	rec, err := s.enc.structLine(v)
+	if err != nil {
+		return err
+	}
+	return s.put(rec)
+}
+
+// EncodeRow writes row, see Encoder.EncodeRow.
+func (s *SyncEncoder) EncodeRow(row *Row) error {
+	if s.queue == nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.closed {
+			return ErrEncoderClosed
+		}
+		return s.enc.EncodeRow(row)
+	}
+	if err := checkRow(row); err != nil {
+		return err
+	}
+	//复制记录，调用者可以继续使用row
+	return s.put(&structRecord{
+		pkgPath: row.PkgPath,
+		name:    row.Name,
+		columns: append([]string(nil), row.Columns...),
+		line:    append([]string(nil), row.Values...),
+	})
+}
+
+// Close writes the records queued and flushes the output. It returns the
+// first error of the background writing, if any. Close does not close the
+// underlying io.Writer.
+func (s *SyncEncoder) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrEncoderClosed
+	}
+	s.closed = true
+	s.mu.Unlock()
+	if s.queue == nil {
+		return s.enc.writer.Flush()
+	}
+	close(s.queue)
+	<-s.done
+	if err := s.error(); err != nil {
+		return err
+	}
+	return s.enc.writer.Flush()
+}
@@ -0,0 +1,79 @@
+package gott
+
+import (
+	"strings"
+	"time"
+)
+
+// tagOptions 是属性tt标签中名称之后的选项，用逗号分隔，如
+//
+//	Created time.Time `tt:",time=unixmilli"`
+//
+// 名称部分是类型行中的属性名称，为空时使用属性名，"-"表示不读写该属性，见typeFields。
+type tagOptions string
+
+func parseTag(tag string) (string, tagOptions) {
+	if i := strings.Index(tag, ","); i >= 0 {
+		return tag[:i], tagOptions(tag[i+1:])
+	}
+	return tag, ""
+}
+
+// Get 返回name=value形式选项的值，没有值的选项返回空字符串
+func (o tagOptions) Get(name string) (string, bool) {
+	s := string(o)
+	for s != "" {
+		var opt string
+		if i := strings.Index(s, ","); i >= 0 {
+			opt, s = s[:i], s[i+1:]
+		} else {
+			opt, s = s, ""
+		}
+		if opt == name {
+			return "", true
+		}
+		if strings.HasPrefix(opt, name+"=") {
+			return opt[len(name)+1:], true
+		}
+	}
+	return "", false
+}
+
+// tail 返回name=value形式选项的值，值一直到标签的末尾，可以包含逗号，
+// 用于只能作为最后一个选项的regexp
+func (o tagOptions) tail(name string) (string, bool) {
+	s := string(o)
+	for {
+		if strings.HasPrefix(s, name+"=") {
+			return s[len(name)+1:], true
+		}
+		i := strings.Index(s, ",")
+		if i < 0 {
+			return "", false
+		}
+		s = s[i+1:]
+	}
+}
+
+// codec 是属性值和字符串之间转换的设置，来自Encoder、Decoder的设置和属性的标签
+type codec struct {
+	timeFormat  string
+	location    *time.Location
+	bytesFormat string
+	floatFormat string
+	types       map[ttType][]string //文件中注册的类型，用于接口类型的属性
+}
+
+// with 返回用属性标签选项覆盖后的设置
+func (c codec) with(opts tagOptions) codec {
+	if v, ok := opts.Get("time"); ok {
+		c.timeFormat = v
+	}
+	if v, ok := opts.Get("bytes"); ok {
+		c.bytesFormat = v
+	}
+	if v, ok := opts.Get("float"); ok {
+		c.floatFormat = v
+	}
+	return c
+}
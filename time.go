@@ -0,0 +1,81 @@
+package gott
+
+import (
+	"strconv"
+	"time"
+)
+
+// Time formats which write a time.Time as an integer count since the Unix
+// epoch. They can be used for the TimeFormat of an Encoder or a Decoder and as
+// the time option of a field tag, e.g.
+//
+//	Created time.Time `tt:",time=unixmilli"`
+//
+// Any other non-empty time format is a layout as accepted by time.Format.
+const (
+	TimeUnix      = "unix"
+	TimeUnixMilli = "unixmilli"
+	TimeUnixMicro = "unixmicro"
+	TimeUnixNano  = "unixnano"
+)
+
+// formatTime 按照设置的格式输出时间，默认为RFC3339Nano，保留纳秒和时区偏移
+func formatTime(t time.Time, c codec) string {
+	if c.location != nil {
+		t = t.In(c.location)
+	}
+	switch c.timeFormat {
+	case "":
+		return t.Format(time.RFC3339Nano)
+	case TimeUnix:
+		return strconv.FormatInt(t.Unix(), 10)
+	case TimeUnixMilli:
+		return strconv.FormatInt(t.UnixMilli(), 10)
+	case TimeUnixMicro:
+		return strconv.FormatInt(t.UnixMicro(), 10)
+	case TimeUnixNano:
+		return strconv.FormatInt(t.UnixNano(), 10)
+	default:
+		return t.Format(c.timeFormat)
+	}
+}
+
+// parseTime 按照设置的格式解析时间，没有时区信息的格式使用设置的Location，
+// 没有设置时为UTC
+func parseTime(s string, c codec) (time.Time, error) {
+	loc := c.location
+	if loc == nil {
+		loc = time.UTC
+	}
+	var (
+		t   time.Time
+		n   int64
+		err error
+	)
+	switch c.timeFormat {
+	case TimeUnix, TimeUnixMilli, TimeUnixMicro, TimeUnixNano:
+		if n, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return t, err
+		}
+		switch c.timeFormat {
+		case TimeUnix:
+			t = time.Unix(n, 0)
+		case TimeUnixMilli:
+			t = time.UnixMilli(n)
+		case TimeUnixMicro:
+			t = time.UnixMicro(n)
+		default:
+			t = time.Unix(0, n)
+		}
+		return t.In(loc), nil
+	case "":
+		//RFC3339Nano也可以解析旧的RFC3339格式
+		t, err = time.ParseInLocation(time.RFC3339Nano, s, loc)
+	default:
+		t, err = time.ParseInLocation(c.timeFormat, s, loc)
+	}
+	if err == nil && c.location != nil {
+		t = t.In(c.location)
+	}
+	return t, err
+}
@@ -0,0 +1,64 @@
+package gott
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrInvalidUTF8 is returned for invalid UTF-8 when the UTF8Mode is UTF8Error.
+var ErrInvalidUTF8 = errors.New("invalid UTF-8")
+
+// A UTF8Mode tells a Reader or a Writer what to do with field content that is
+// not valid UTF-8.
+type UTF8Mode int
+
+const (
+	// UTF8Preserve keeps the original bytes exactly (the default).
+	UTF8Preserve UTF8Mode = iota
+	// UTF8Replace replaces each invalid byte with U+FFFD.
+	UTF8Replace
+	// UTF8Error fails with an error wrapping ErrInvalidUTF8; a Reader returns
+	// a *ParseError positioned at the first invalid byte.
+	UTF8Error
+)
+
+// advance 返回读取s之后的位置
+func (p position) advance(s string) position {
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		return position{p.line + strings.Count(s, "\n"), utf8.RuneCountInString(s[i+1:]) + 1}
+	}
+	return position{p.line, p.column + utf8.RuneCountInString(s)}
+}
+
+// invalidUTF8 返回s中第一个无效UTF-8字节的位置，没有时返回-1
+func invalidUTF8(s string) int {
+	for i, r := range s {
+		if r == utf8.RuneError {
+			if _, size := utf8.DecodeRuneInString(s[i:]); size == 1 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// checkUTF8 按照设置处理引用字段的内容，start是内容开始的位置
+func (dec *Reader) checkUTF8(s string, start position) (string, error) {
+	if dec.InvalidUTF8 == UTF8Preserve || utf8.ValidString(s) {
+		return s, nil
+	}
+	if dec.InvalidUTF8 == UTF8Replace {
+		return replaceUTF8(s), nil
+	}
+	return s, dec.parseError(start.advance(s[:invalidUTF8(s)]), ErrInvalidUTF8)
+}
+
+// replaceUTF8 把每个无效的字节替换为U+FFFD，和ReadRune的处理一致
+func replaceUTF8(s string) string {
+	b := strings.Builder{}
+	for _, r := range s {
+		b.WriteRune(r)
+	}
+	return b.String()
+}
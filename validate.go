@@ -0,0 +1,285 @@
+package gott
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Validator is implemented by types that check themselves. Decode calls
+// Validate after the record has been decoded and the tag constraints of the
+// fields have been checked.
+type Validator interface {
+	Validate() error
+}
+
+// The errors of the tag constraints, wrapped by ValidationError. The
+// constraints are options of the tt tag of a field:
+//
+//	Name  string  `tt:",required,len=8"`
+//	Count int     `tt:",min=1,max=100"`
+//	State string  `tt:",oneof=new open closed"`
+//	Code  string  `tt:",regexp=^[A-Z]{2,3}$"`
+//
+// required rejects the zero value. min and max limit numbers, and the length
+// of strings (in runes), slices and maps; len requires an exact length. oneof
+// takes the allowed values separated by spaces. regexp must be the last
+// option, its pattern runs to the end of the tag and may contain commas.
+var (
+	ErrRequired = errors.New("required field is empty")
+	ErrMin      = errors.New("less than min")
+	ErrMax      = errors.New("greater than max")
+	ErrLen      = errors.New("wrong length")
+	ErrOneOf    = errors.New("not one of the allowed values")
+	ErrRegexp   = errors.New("not matching the pattern")
+)
+
+// A ValidationError is a constraint violated by a decoded record. Field is
+// empty for the errors returned by Validate.
+type ValidationError struct {
+	Record int    // Number of the data record, starting at 1
+	Line   int    // Line where the record starts
+	Field  string // Name of the field
+	Err    error  // The actual error
+}
+
+func (e *ValidationError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("record:%d,line:%d validation error:%s", e.Record, e.Line, e.Err)
+	}
+	return fmt.Sprintf("record:%d,line:%d,field:%s validation error:%s", e.Record, e.Line, e.Field, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationErrors is returned by Decode when the record violates some
+// constraints. The record is still fully decoded into the value and the
+// Decoder stays at the next record, so the errors of a whole file can be
+// collected. The errors of the child records, see Encoder.Encode, are
+// returned along with those of their parent:
+//
+//	var all gott.ValidationErrors
+//	for {
+//		err := dec.Decode(&v)
+//		var errs gott.ValidationErrors
+//		if errors.As(err, &errs) {
+//			all = append(all, errs...)
+//			continue
+//		}
+//		...
+//	}
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, v := range e {
+		msgs[i] = v.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e ValidationErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, v := range e {
+		errs[i] = v
+	}
+	return errs
+}
+
+// validate 检查从第line行开始的第record个记录v的属性的标签约束，然后调用Validate方法，
+// 违反的约束作为ValidationErrors返回
+func (t *Decoder) validate(v interface{}, value reflect.Value, record, line int) error {
+	fields, err := constrainedFields(value.Type())
+	if err != nil {
+		return err
+	}
+	var errs ValidationErrors
+	for _, f := range fields {
+		//经过空的嵌入指针的属性没有值
+		fv, _ := fieldValue(value, f.index)
+		if fv.Kind() == reflect.Interface {
+			fv = fv.Elem()
+		}
+		e, err := checkField(fv, f.opts)
+		if err != nil {
+			//标签本身错误，不是数据的问题
+			return fmt.Errorf("field %s: %w", f.name, err)
+		}
+		if e != nil {
+			errs = append(errs, &ValidationError{Record: record, Line: line, Field: f.name, Err: e})
+		}
+	}
+	if vd, ok := v.(Validator); ok {
+		if e := vd.Validate(); e != nil {
+			errs = append(errs, &ValidationError{Record: record, Line: line, Err: e})
+		}
+	}
+	if errs != nil {
+		return errs
+	}
+	return nil
+}
+
+// constraints 是标签中的约束选项
+var constraints = []string{"required", "min", "max", "len", "oneof", "regexp"}
+
+// constrained 缓存结构类型中有约束选项的属性
+var constrained sync.Map // map[reflect.Type][]field
+
+// constrainedFields 返回结构t中有约束选项的属性，没有时为nil
+func constrainedFields(t reflect.Type) ([]field, error) {
+	if fields, ok := constrained.Load(t); ok {
+		return fields.([]field), nil
+	}
+	all, err := typeFields(t)
+	if err != nil {
+		return nil, err
+	}
+	var fields []field
+	for _, f := range all {
+		for _, name := range constraints {
+			//regexp的值可能包含逗号，但Get能判断其是否存在
+			if _, ok := f.opts.Get(name); ok {
+				fields = append(fields, f)
+				break
+			}
+		}
+	}
+	constrained.Store(t, fields)
+	return fields, nil
+}
+
+// checkField 检查属性值是否满足标签约束，返回违反的约束，标签错误时返回err
+func checkField(v reflect.Value, opts tagOptions) (violation, err error) {
+	if _, ok := opts.Get("required"); ok && (!v.IsValid() || v.IsZero()) {
+		return ErrRequired, nil
+	}
+	//空指针没有值可以检查
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil, nil
+	}
+	if s, ok := opts.Get("min"); ok {
+		n, limit, err := measure(v, "min", s)
+		if err != nil {
+			return nil, err
+		}
+		if n < limit {
+			return fmt.Errorf("%w %s", ErrMin, s), nil
+		}
+	}
+	if s, ok := opts.Get("max"); ok {
+		n, limit, err := measure(v, "max", s)
+		if err != nil {
+			return nil, err
+		}
+		if n > limit {
+			return fmt.Errorf("%w %s", ErrMax, s), nil
+		}
+	}
+	if s, ok := opts.Get("len"); ok {
+		if !hasLength(v) {
+			return nil, fmt.Errorf("option len not supported by %s", v.Type())
+		}
+		n, limit, err := measure(v, "len", s)
+		if err != nil {
+			return nil, err
+		}
+		if n != limit {
+			return fmt.Errorf("%w %v, want %s", ErrLen, n, s), nil
+		}
+	}
+	if s, ok := opts.Get("oneof"); ok {
+		var text string
+		switch v.Kind() {
+		case reflect.String:
+			text = v.String()
+		case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			text = fmt.Sprint(v.Interface())
+		default:
+			return nil, fmt.Errorf("option oneof not supported by %s", v.Type())
+		}
+		found := false
+		for _, one := range strings.Fields(s) {
+			if one == text {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%w %q", ErrOneOf, text), nil
+		}
+	}
+	if s, ok := opts.tail("regexp"); ok {
+		if v.Kind() != reflect.String {
+			return nil, fmt.Errorf("option regexp not supported by %s", v.Type())
+		}
+		re, err := compileRegexp(s)
+		if err != nil {
+			return nil, err
+		}
+		if !re.MatchString(v.String()) {
+			return fmt.Errorf("%w %s", ErrRegexp, s), nil
+		}
+	}
+	return nil, nil
+}
+
+// hasLength 返回v是否是有长度的类型
+func hasLength(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return true
+	}
+	return false
+}
+
+// measure 返回min、max、len约束比较的数值和约束的值，数字是本身，其他是长度
+func measure(v reflect.Value, name, limit string) (float64, float64, error) {
+	l, err := strconv.ParseFloat(limit, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid option %s=%s", name, limit)
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), l, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), l, nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), l, nil
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), l, nil
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), l, nil
+	}
+	return 0, 0, fmt.Errorf("option %s not supported by %s", name, v.Type())
+}
+
+// regexps 缓存编译过的正则表达式
+var regexps sync.Map
+
+func compileRegexp(expr string) (*regexp.Regexp, error) {
+	if re, ok := regexps.Load(expr); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	regexps.Store(expr, re)
+	return re, nil
+}
@@ -0,0 +1,222 @@
+package gott
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// ErrNotRegistered is returned when an interface field holds a value, or is
+// read with a type, that was not registered.
+var ErrNotRegistered = errors.New("type not registered")
+
+// 注册的具体类型，用于接口类型的属性
+var (
+	registryMu sync.RWMutex
+	nameToType = map[string]reflect.Type{}
+	typeToName = map[reflect.Type]string{}
+)
+
+// Register records the concrete type of value, a struct or a pointer to a
+// struct, under the name PkgPath.Name of the struct type. See RegisterName.
+func Register(value interface{}) {
+	rt := reflect.TypeOf(value)
+	st := rt
+	if st != nil && st.Kind() == reflect.Ptr {
+		st = st.Elem()
+	}
+	if st == nil || st.Name() == "" {
+		panic(fmt.Sprintf("gott: Register of unnamed type %v", rt))
+	}
+	RegisterName(st.PkgPath()+"."+st.Name(), value)
+}
+
+// RegisterName records the concrete type of value, a struct or a pointer to
+// a struct, under name, so that it can be stored in the interface fields of
+// the structs encoded.
+//
+// The type is registered in the file like the structs encoded, with the part
+// of name before its last dot as the package path and the rest as the type
+// name, and versioned in the same way when its fields change. A field of
+// interface type holding a registered value is written as a nested TT record:
+// the package path, the versioned type name and the fields of the value in the
+// order of the registered columns. The Decoder allocates a value of the
+// registered type, a pointer if value was one, decodes the columns into the
+// fields of the same name and stores it in the interface field, so records
+// written before a field was added still decode. A nil interface is written as
+// an empty field; any other value whose type is not registered makes Encode
+// return ErrNotRegistered. The registered value can't have child records.
+//
+// Like encoding/gob, RegisterName panics if the name or the type is already
+// registered with another type or name. It is usually called in an init
+// function.
+func RegisterName(name string, value interface{}) {
+	rt := reflect.TypeOf(value)
+	st := rt
+	if st != nil && st.Kind() == reflect.Ptr {
+		st = st.Elem()
+	}
+	if name == "" || st == nil || st.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("gott: RegisterName %q of %v, want a struct or a pointer to a struct", name, rt))
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if t, ok := nameToType[name]; ok && t != rt {
+		panic(fmt.Sprintf("gott: registering duplicate types for %q: %v != %v", name, t, rt))
+	}
+	if n, ok := typeToName[st]; ok && n != name {
+		panic(fmt.Sprintf("gott: registering duplicate names for %v: %q != %q", rt, n, name))
+	}
+	nameToType[name] = rt
+	typeToName[st] = name
+}
+
+// registeredName 返回值v的具体类型注册的名称
+func registeredName(v reflect.Value) (string, bool) {
+	t := v.Type()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	name, ok := typeToName[t]
+	return name, ok
+}
+
+// variant 是接口类型的属性中注册过的具体值
+type variant struct {
+	name  string
+	value reflect.Value
+}
+
+// splitName 把注册的名称在最后一个点分为包路径和类型名称
+func splitName(name string) (pkgPath, tyName string) {
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return "", name
+}
+
+// variantLine 把接口属性中的具体值编码为数据行，空指针返回nil。
+// 解码时具体值不经过钩子和校验，编码时也不调用钩子，使两边一致
+func (enc *Encoder) variantLine(v variant) (*structRecord, error) {
+	if v.value.Kind() == reflect.Ptr && v.value.IsNil() {
+		return nil, nil
+	}
+	rec, err := enc.encodeStruct(v.value.Interface(), false)
+	if err != nil {
+		return nil, err
+	}
+	if len(rec.children) > 0 {
+		return nil, fmt.Errorf("the registered type %q has child records", v.name)
+	}
+	rec.pkgPath, rec.name = splitName(v.name)
+	return rec, nil
+}
+
+// writeVariants 注册接口属性中具体值的类型，把具体值写为属性的文本：
+// 包路径、带版本的类型名称和属性值组成的一行TT记录
+func (enc *Encoder) writeVariants(rec *structRecord) error {
+	for i, vr := range rec.variants {
+		if vr == nil {
+			continue
+		}
+		if err := enc.writeVariants(vr); err != nil {
+			return err
+		}
+		ty, err := enc.registerType(vr.pkgPath, vr.name, vr.columns)
+		if err != nil {
+			return err
+		}
+		text, err := joinRecord(append([]string{ty.PkgPath, ty.typeName()}, vr.line...))
+		if err != nil {
+			return err
+		}
+		rec.line[i] = text
+	}
+	return nil
+}
+
+// joinRecord 把记录写为一行TT文本，不带换行
+func joinRecord(record []string) (string, error) {
+	b := &strings.Builder{}
+	w := NewWriter(b)
+	if err := w.Write(record); err != nil {
+		return "", err
+	}
+	if err := w.Flush(); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+// decodeVariant 解析writeVariants写入的记录，按照文件中注册的属性名称解码到新建的具体值，
+// 存入接口类型的value
+func decodeVariant(encValue string, value reflect.Value, c codec) error {
+	if encValue == "" {
+		value.Set(reflect.Zero(value.Type()))
+		return nil
+	}
+	r := NewReader(strings.NewReader(encValue))
+	record, err := r.Read()
+	if err != nil && (err != io.EOF || record == nil) {
+		return err
+	}
+	if len(record) < 2 {
+		return fmt.Errorf("%w: invalid variant %q", ErrTypeLine, encValue)
+	}
+	ty, err := parseType(record[0], record[1])
+	if err != nil {
+		return err
+	}
+	columns, ok := c.types[ty]
+	if !ok {
+		return fmt.Errorf("the type %s not registered in the file", ty)
+	}
+	name := ty.Name
+	if ty.PkgPath != "" {
+		name = ty.PkgPath + "." + ty.Name
+	}
+	registryMu.RLock()
+	rt, ok := nameToType[name]
+	registryMu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrNotRegistered, name)
+	}
+	if len(record)-2 != len(columns) {
+		return fmt.Errorf("%w, has %d fields, type %s has %d props", ErrFieldCount, len(record)-2, ty, len(columns))
+	}
+	st := rt
+	if st.Kind() == reflect.Ptr {
+		st = st.Elem()
+	}
+	nv := reflect.New(st)
+	for i, col := range columns {
+		colName, colOpts := parseTag(col)
+		f, err := findField(st, colName)
+		if err != nil {
+			return err
+		}
+		if f == nil {
+			return fmt.Errorf("can't find the prop:%s at type %s", colName, st)
+		}
+		fv, err := fieldValueAlloc(nv.Elem(), f.index)
+		if err != nil {
+			return err
+		}
+		if err := decode(record[i+2], fv, c.with(f.opts).with(colOpts)); err != nil {
+			return fmt.Errorf("%s.%s: %w", name, colName, err)
+		}
+	}
+	if rt.Kind() != reflect.Ptr {
+		nv = nv.Elem()
+	}
+	if !nv.Type().AssignableTo(value.Type()) {
+		return fmt.Errorf("type %s of %q doesn't implement %s", nv.Type(), name, value.Type())
+	}
+	value.Set(nv)
+	return nil
+}